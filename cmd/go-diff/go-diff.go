@@ -12,6 +12,11 @@ import (
 
 // A diagnostic program to aid in debugging diff parsing or printing
 // errors.
+//
+// With the "filter" subcommand, it prints only the files of the diff whose
+// paths match the given patterns instead:
+//
+//	go-diff filter [-f file] pattern...
 
 const stdin = "<stdin>"
 
@@ -22,18 +27,13 @@ var (
 
 func main() {
 	log.SetFlags(0)
+	if len(os.Args) > 1 && os.Args[1] == "filter" {
+		filter(os.Args[2:])
+		return
+	}
 	flag.Parse()
 
-	var diffFile *os.File
-	if *diffPath == stdin {
-		diffFile = os.Stdin
-	} else {
-		var err error
-		diffFile, err = os.Open(*diffPath)
-		if err != nil {
-			log.Fatal(err)
-		}
-	}
+	diffFile := openDiff(*diffPath)
 	defer diffFile.Close()
 
 	r := diff.NewMultiFileDiffReader(diffFile)
@@ -75,3 +75,60 @@ func main() {
 		}
 	}
 }
+
+// filter implements the filter subcommand.
+func filter(args []string) {
+	fs := flag.NewFlagSet("filter", flag.ExitOnError)
+	path := fs.String("f", stdin, "filename of diff (default: stdin)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: go-diff filter [-f file] pattern...")
+		fmt.Fprintln(fs.Output(), "\nPatterns are gitignore patterns (\"!pattern\" to exclude) or git pathspecs")
+		fmt.Fprintln(fs.Output(), "(\":(exclude)pattern\", \":(glob)pattern\", ...). As in .gitignore, the last")
+		fmt.Fprintln(fs.Output(), "pattern that matches a file decides whether it is printed.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	f, err := diff.NewPathFilter(fs.Args()...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	diffFile := openDiff(*path)
+	defer diffFile.Close()
+
+	r := diff.NewFilterReader(diff.NewMultiFileDiffReader(diffFile), f)
+	for {
+		fdiff, err := r.ReadFile()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatalf("err read: %s", err)
+		}
+		out, err := diff.PrintFileDiff(fdiff)
+		if err != nil {
+			log.Fatalf("err print orig(%s) new(%s): %s", fdiff.OrigName, fdiff.NewName, err)
+		}
+		if _, err := os.Stdout.Write(out); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, line := range r.Epilogue() {
+		if _, err := fmt.Fprintln(os.Stdout, line); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// openDiff opens the diff file at path, or returns stdin.
+func openDiff(path string) *os.File {
+	if path == stdin {
+		return os.Stdin
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return f
+}
@@ -0,0 +1,237 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+)
+
+// A Side is one of the two sides of a diff.
+type Side int
+
+const (
+	// SideOrig is the original file.
+	SideOrig Side = iota
+	// SideNew is the new file.
+	SideNew
+)
+
+func (s Side) String() string {
+	if s == SideOrig {
+		return "orig"
+	}
+	return "new"
+}
+
+// A Comment is a review comment anchored to a line of a diff.
+type Comment struct {
+	// Path is the path of the file, without the "a/" or "b/" prefix git
+	// adds.
+	Path string
+	// Side is the side of the diff the line is on.
+	Side Side
+	// Line is the 1-indexed line of the file on that side.
+	Line int32
+	// Snippet is the text of the line (without its newline), if known. It
+	// is used to find the line if it moved.
+	Snippet string
+}
+
+// A RelocatedComment is where a Comment is in a later revision of a patch.
+type RelocatedComment struct {
+	// Comment is the comment at its new place. Its Line is 0 if the
+	// comment is outdated.
+	Comment
+	// Outdated is whether the line the comment is on was changed or
+	// removed and could not be found by its content.
+	Outdated bool
+	// ContentMatched is whether the line was found by its content,
+	// because the line at its mapped position differs.
+	ContentMatched bool
+}
+
+// RelocateComments moves comments made on the revision from of a patch to
+// the revision to, returning where each comment is in to. Comments on the
+// new side follow their lines through the changes between the revisions
+// (see InterdiffFile); comments on the original side follow the base as it
+// moved between the revisions. If a comment's line was changed, or is
+// found to differ from the comment's Snippet (or from the line's text in
+// from), it is looked for by its content among the lines of to's hunks,
+// and is outdated if it is not found.
+func RelocateComments(from, to []*FileDiff, comments []Comment) ([]RelocatedComment, error) {
+	type file struct {
+		from, to  *FileDiff
+		interdiff *FileDiff
+		mapper    *LineMapper
+	}
+	files := make(map[string]*file)
+	get := func(path string) (*file, error) {
+		if f, ok := files[path]; ok {
+			return f, nil
+		}
+		f := &file{from: findFileDiff(from, path), to: findFileDiff(to, path)}
+		if f.from == nil {
+			f.from = &FileDiff{}
+		}
+		if f.to == nil {
+			f.to = &FileDiff{}
+		}
+		var err error
+		if f.interdiff, err = InterdiffFile(f.from, f.to); err != nil {
+			return nil, err
+		}
+		if f.mapper, err = NewLineMapper(f.interdiff); err != nil {
+			return nil, err
+		}
+		files[path] = f
+		return f, nil
+	}
+
+	relocated := make([]RelocatedComment, len(comments))
+	for i, c := range comments {
+		f, err := get(c.Path)
+		if err != nil {
+			return nil, err
+		}
+		if c.Side == SideNew {
+			relocated[i], err = relocateNewComment(c, f.from, f.to, f.interdiff, f.mapper)
+		} else {
+			relocated[i], err = relocateOrigComment(c, f.from, f.to)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return relocated, nil
+}
+
+// findFileDiff returns the first of fds whose original or new file has the
+// given path, or nil.
+func findFileDiff(fds []*FileDiff, path string) *FileDiff {
+	for _, fd := range fds {
+		if diffPath(fd.NewName) == path || diffPath(fd.OrigName) == path {
+			return fd
+		}
+	}
+	return nil
+}
+
+func relocateNewComment(c Comment, from, to, interdiff *FileDiff, m *LineMapper) (RelocatedComment, error) {
+	shift, err := rebaseShift(from, to, c)
+	if err != nil {
+		return RelocatedComment{}, err
+	}
+	known := fragmentLines(to.NewFragments())
+	for line, text := range fragmentLines(interdiff.NewFragments()) {
+		known[line] = text
+	}
+	snippet := commentSnippet(c, fragmentLines(from.NewFragments()))
+
+	// The interdiff applies to from's new file as it is once moved to to's
+	// base.
+	ml := m.Map(c.Line + shift)
+	if !ml.Deleted {
+		return relocateComment(c, ml.Line, 0, 0, snippet, known), nil
+	}
+	// Look for the line among the lines that replaced it.
+	return relocateComment(c, 0, ml.Before+1, ml.After-1, snippet, known), nil
+}
+
+func relocateOrigComment(c Comment, from, to *FileDiff) (RelocatedComment, error) {
+	shift, err := rebaseShift(from, to, c)
+	if err != nil {
+		return RelocatedComment{}, err
+	}
+	known := fragmentLines(to.OrigFragments())
+	snippet := commentSnippet(c, fragmentLines(from.OrigFragments()))
+	return relocateComment(c, c.Line+shift, 0, 0, snippet, known), nil
+}
+
+// rebaseShift returns how many lines the comment's line moves when from's
+// hunks are moved to to's base (see rebaseHunks): as many as the last hunk
+// that starts at or before the line on the comment's side, or else the
+// first hunk.
+func rebaseShift(from, to *FileDiff, c Comment) (int32, error) {
+	moved, err := rebaseHunks(from.Hunks, to.Hunks)
+	if err != nil {
+		return 0, err
+	}
+	var shift int32
+	for i, h := range from.Hunks {
+		start, lines, movedStart := h.OrigStartLine, h.OrigLines, moved[i].OrigStartLine
+		if c.Side == SideNew {
+			start, lines, movedStart = h.NewStartLine, h.NewLines, moved[i].NewStartLine
+		}
+		if i > 0 && hunkBegin(start, lines) >= c.Line {
+			break
+		}
+		shift = movedStart - start
+	}
+	return shift, nil
+}
+
+// commentSnippet returns the comment's Snippet, or else the line's text in
+// old, the lines known on its side of the revision it was made on.
+func commentSnippet(c Comment, old map[int32]string) string {
+	if c.Snippet != "" {
+		return c.Snippet
+	}
+	return old[c.Line]
+}
+
+// relocateComment places c at line if it is not 0 and its text is not
+// known to differ from snippet. Otherwise it looks for snippet among the
+// known lines, first from lo to hi and then (if it is there only once) in
+// all of them.
+func relocateComment(c Comment, line, lo, hi int32, snippet string, known map[int32]string) RelocatedComment {
+	if line > 0 {
+		if text, ok := known[line]; !ok || snippet == "" || sameLine(text, snippet) {
+			c.Line = line
+			return RelocatedComment{Comment: c}
+		}
+		lo, hi = line, line
+	}
+	if strings.TrimSpace(snippet) != "" {
+		var best int32
+		for l, text := range known {
+			if l >= lo && l <= hi && sameLine(text, snippet) && (best == 0 || abs32(l-line) < abs32(best-line) || (abs32(l-line) == abs32(best-line) && l < best)) {
+				best = l
+			}
+		}
+		if best == 0 {
+			for l, text := range known {
+				if sameLine(text, snippet) {
+					if best != 0 {
+						best = 0
+						break
+					}
+					best = l
+				}
+			}
+		}
+		if best != 0 {
+			c.Line = best
+			return RelocatedComment{Comment: c, ContentMatched: true}
+		}
+	}
+	c.Line = 0
+	return RelocatedComment{Comment: c, Outdated: true}
+}
+
+// sameLine reports whether two lines are the same, ignoring leading and
+// trailing white space.
+func sameLine(a, b string) bool {
+	return strings.TrimSpace(a) == strings.TrimSpace(b)
+}
+
+// fragmentLines returns the lines of fragments (without their line endings)
+// by their 1-indexed line number.
+func fragmentLines(fragments []Fragment) map[int32]string {
+	lines := make(map[int32]string)
+	for _, f := range fragments {
+		for i, line := range splitLines(f.Text) {
+			line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte{'\n'}), []byte{'\r'})
+			lines[f.StartLine+int32(i)] = string(line)
+		}
+	}
+	return lines
+}
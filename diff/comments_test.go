@@ -0,0 +1,145 @@
+package diff
+
+import "testing"
+
+func TestRelocateComments(t *testing.T) {
+	from, err := ParseMultiFileDiff([]byte(`--- a/changed
++++ b/changed
+@@ -1,4 +1,4 @@
+ a
+-b
++B1
+ c
+ d
+--- a/moved
++++ b/moved
+@@ -1,3 +1,4 @@
+ a
++foo
+ b
+ c
+--- a/drift
++++ b/drift
+@@ -4,3 +4,3 @@
+ d
+-e
++E
+ f
+@@ -10,2 +10,3 @@
+ j
++x
+ k
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := ParseMultiFileDiff([]byte(`--- a/changed
++++ b/changed
+@@ -1,4 +1,5 @@
+ a
+-b
++B2
++x
+ c
+ d
+--- a/moved
++++ b/moved
+@@ -1,3 +1,4 @@
+ a
+ b
++foo
+ c
+--- a/drift
++++ b/drift
+@@ -7,3 +7,3 @@
+ d
+-e
++E
+ f
+@@ -13,2 +13,3 @@
+ j
++x
+ k
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comments := []Comment{
+		{Path: "changed", Side: SideNew, Line: 3},
+		{Path: "changed", Side: SideNew, Line: 2},
+		{Path: "moved", Side: SideNew, Line: 2},
+		{Path: "drift", Side: SideOrig, Line: 5},
+		{Path: "drift", Side: SideNew, Line: 5, Snippet: "E"},
+		{Path: "untouched", Side: SideNew, Line: 10},
+	}
+	want := []RelocatedComment{
+		{Comment: Comment{Path: "changed", Side: SideNew, Line: 4}},
+		{Comment: Comment{Path: "changed", Side: SideNew}, Outdated: true},
+		{Comment: Comment{Path: "moved", Side: SideNew, Line: 3}, ContentMatched: true},
+		{Comment: Comment{Path: "drift", Side: SideOrig, Line: 8}},
+		{Comment: Comment{Path: "drift", Side: SideNew, Line: 8, Snippet: "E"}},
+		{Comment: Comment{Path: "untouched", Side: SideNew, Line: 10}},
+	}
+	got, err := RelocateComments(from, to, comments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("comment %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRelocateComments_MovedFunction(t *testing.T) {
+	// A's body is the same as B's, and A moves (and is indented) after B.
+	from, err := ParseMultiFileDiff([]byte(`--- a/f.go
++++ b/f.go
+@@ -1,3 +1,4 @@
+ func A() {
++	log()
+ 	return x
+ }
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := ParseMultiFileDiff([]byte(`--- a/f.go
++++ b/f.go
+@@ -1,7 +1,8 @@
+-func A() {
+-	return x
+-}
+-
+ func B() {
+ 	return x
+ }
++
++	func A() {
++		log()
++		return x
++	}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	comments := []Comment{
+		{Path: "f.go", Side: SideNew, Line: 2},
+		{Path: "f.go", Side: SideNew, Line: 3},
+	}
+	want := []RelocatedComment{
+		{Comment: Comment{Path: "f.go", Side: SideNew, Line: 6}, ContentMatched: true},
+		// "return x" is in both A and B, so it is not known which it is.
+		{Comment: Comment{Path: "f.go", Side: SideNew}, Outdated: true},
+	}
+	got, err := RelocateComments(from, to, comments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("comment %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
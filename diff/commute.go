@@ -0,0 +1,165 @@
+package diff
+
+import "fmt"
+
+// ErrConflict is returned by Commute when two patches cannot be reordered
+// because they change the same or adjacent lines of a file.
+type ErrConflict struct {
+	// Path is the path of the file (set by CommuteMultiFileDiff).
+	Path string
+	// Line is the 1-indexed line of the file between the patches at which
+	// they conflict, or 0 if one patch adds, deletes or renames the file
+	// the other changes.
+	Line int32
+}
+
+func (e *ErrConflict) Error() string {
+	msg := "patches conflict"
+	if e.Path != "" {
+		msg += " in " + e.Path
+	}
+	if e.Line > 0 {
+		msg += fmt.Sprintf(" at line %d", e.Line)
+	}
+	return msg
+}
+
+// Commute reorders two sequential diffs of a file: given p and then q, it
+// returns q2 and p2 such that applying q2 and then p2 has the same effect,
+// where q2 makes q's changes and p2 makes p's. If a change of q touches
+// lines that p changes (or the lines right next to them), the patches do not
+// commute and Commute returns an *ErrConflict.
+//
+// The hunks of q2 and p2 only keep the context lines of q and p that the
+// other patch leaves alone, so they may have less context. q2 and p2 keep
+// the file names and headers of q and p.
+func Commute(p, q *FileDiff) (q2, p2 *FileDiff, err error) {
+	pcs, err := hunkChanges(p.Hunks)
+	if err != nil {
+		return nil, nil, err
+	}
+	qcs, err := hunkChanges(q.Hunks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Both patches' changes are placed in the file between them, where p's
+	// changes cover their new lines and q's their original lines.
+	pEnd := func(c *change) int32 { return c.new + c.newLines() }
+	qEnd := func(c *change) int32 { return c.orig + c.origLines() }
+
+	var pDelta int32
+	qcs2 := make([]change, len(qcs))
+	for i, j := 0, 0; j < len(qcs); j++ {
+		qc := qcs[j]
+		for ; i < len(pcs) && pEnd(&pcs[i]) < qc.orig; i++ {
+			pDelta += pcs[i].newLines() - pcs[i].origLines()
+		}
+		if i < len(pcs) && pcs[i].new <= qEnd(&qc) {
+			line := qc.orig
+			if pcs[i].new > line {
+				line = pcs[i].new
+			}
+			return nil, nil, &ErrConflict{Line: line + 1}
+		}
+		// Keep only the context lines that p leaves alone.
+		if i > 0 {
+			qc.before = lastN(qc.before, qc.orig-pEnd(&pcs[i-1]))
+		}
+		if i < len(pcs) {
+			qc.after = firstN(qc.after, pcs[i].new-qEnd(&qc))
+		}
+		qc.orig -= pDelta
+		qc.new -= pDelta
+		qcs2[j] = qc
+	}
+
+	var qDelta int32
+	pcs2 := make([]change, len(pcs))
+	for i, j := 0, 0; i < len(pcs); i++ {
+		pc := pcs[i]
+		for ; j < len(qcs) && qEnd(&qcs[j]) < pc.new; j++ {
+			qDelta += qcs[j].newLines() - qcs[j].origLines()
+		}
+		if j > 0 {
+			pc.before = lastN(pc.before, pc.new-qEnd(&qcs[j-1]))
+		}
+		if j < len(qcs) {
+			pc.after = firstN(pc.after, qcs[j].orig-pEnd(&pc))
+		}
+		pc.orig += qDelta
+		pc.new += qDelta
+		pcs2[i] = pc
+	}
+
+	q2, p2 = commutedFileDiff(q, joinChanges(qcs2)), commutedFileDiff(p, joinChanges(pcs2))
+	if anyCRLFLines(p.Hunks, q.Hunks) {
+		for _, fd := range []*FileDiff{q2, p2} {
+			for _, h := range fd.Hunks {
+				recordCRLF(h)
+			}
+		}
+	}
+	return q2, p2, nil
+}
+
+// CommuteMultiFileDiff reorders two sequential multi-file diffs (see
+// Commute). A file of q is commuted with the file of p whose new name is
+// its original name. If either patch adds, deletes or renames a file that
+// the other changes, the patches conflict.
+func CommuteMultiFileDiff(p, q []*FileDiff) (q2, p2 []*FileDiff, err error) {
+	byPath := make(map[string]int, len(p))
+	for i, fd := range p {
+		byPath[fileDiffPath(fd)] = i
+	}
+
+	p2 = append([]*FileDiff(nil), p...)
+	for _, fd := range q {
+		path := diffPath(fd.OrigName)
+		if path == "" {
+			path = diffPath(fd.NewName)
+		}
+		i, ok := byPath[path]
+		if !ok || path == "" {
+			q2 = append(q2, fd)
+			continue
+		}
+		other := p[i]
+		if diffPath(other.OrigName) != path || diffPath(other.NewName) != path || diffPath(fd.OrigName) != path || diffPath(fd.NewName) != path {
+			return nil, nil, &ErrConflict{Path: path}
+		}
+		fq, fp, err := Commute(other, fd)
+		if err != nil {
+			if e, ok := err.(*ErrConflict); ok {
+				e.Path = path
+			}
+			return nil, nil, err
+		}
+		q2 = append(q2, fq)
+		p2[i] = fp
+	}
+	return q2, p2, nil
+}
+
+// commutedFileDiff returns a copy of fd with the given hunks.
+func commutedFileDiff(fd *FileDiff, hunks []*Hunk) *FileDiff {
+	c := *fd
+	c.Hunks = hunks
+	return &c
+}
+
+// firstN returns the first n of lines (all of them if there are fewer).
+func firstN(lines [][]byte, n int32) [][]byte {
+	if int(n) < len(lines) {
+		return lines[:n]
+	}
+	return lines
+}
+
+// lastN returns the last n of lines (all of them if there are fewer).
+func lastN(lines [][]byte, n int32) [][]byte {
+	if int(n) < len(lines) {
+		return lines[len(lines)-int(n):]
+	}
+	return lines
+}
@@ -0,0 +1,116 @@
+package diff
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCommute(t *testing.T) {
+	tests := []struct {
+		name   string
+		p, q   string
+		q2, p2 string
+	}{
+		{
+			name: "insertion before",
+			p:    "@@ -1,4 +1,5 @@\n a\n+x\n b\n c\n d\n",
+			q:    "@@ -5,5 +5,5 @@\n d\n e\n-f\n+F\n g\n h\n",
+			q2:   "@@ -4,5 +4,5 @@\n d\n e\n-f\n+F\n g\n h\n",
+			p2:   "@@ -1,4 +1,5 @@\n a\n+x\n b\n c\n d\n",
+		},
+		{
+			name: "deletion after",
+			p:    "@@ -7,3 +7,2 @@\n g\n-h\n i\n",
+			q:    "@@ -1,2 +1,3 @@\n a\n+x\n b\n",
+			q2:   "@@ -1,2 +1,3 @@\n a\n+x\n b\n",
+			p2:   "@@ -8,3 +8,2 @@\n g\n-h\n i\n",
+		},
+		{
+			name: "shared context",
+			p:    "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			q:    "@@ -2,4 +2,4 @@\n B\n c\n-d\n+D\n e\n",
+			q2:   "@@ -3,3 +3,3 @@\n c\n-d\n+D\n e\n",
+			p2:   "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := ParseHunks([]byte(test.p))
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, err := ParseHunks([]byte(test.q))
+			if err != nil {
+				t.Fatal(err)
+			}
+			q2, p2, err := Commute(&FileDiff{Hunks: p}, &FileDiff{Hunks: q})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range []struct {
+				name string
+				fd   *FileDiff
+				want string
+			}{{"q2", q2, test.q2}, {"p2", p2, test.p2}} {
+				got, err := PrintHunks(c.fd.Hunks)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != c.want {
+					t.Errorf("%s: got\n%s\nwant\n%s", c.name, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCommute_conflict(t *testing.T) {
+	p, err := ParseHunks([]byte("@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := ParseHunks([]byte("@@ -2,3 +2,3 @@\n B\n-c\n+C\n d\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = Commute(&FileDiff{Hunks: p}, &FileDiff{Hunks: q})
+	var e *ErrConflict
+	if !errors.As(err, &e) || e.Line != 3 {
+		t.Errorf("got error %v, want conflict at line 3", err)
+	}
+}
+
+func TestCommuteMultiFileDiff(t *testing.T) {
+	p, err := ParseMultiFileDiff([]byte("--- a/f\n+++ b/f\n@@ -1,2 +1,3 @@\n a\n+x\n b\n--- a/g\n+++ b/g\n@@ -1 +1 @@\n-g\n+G\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := ParseMultiFileDiff([]byte("--- a/h\n+++ b/h\n@@ -1 +1 @@\n-h\n+H\n--- a/f\n+++ b/f\n@@ -5,2 +5,2 @@\n d\n-e\n+E\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q2, p2, err := CommuteMultiFileDiff(p, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := PrintMultiFileDiff(q2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "--- a/h\n+++ b/h\n@@ -1,1 +1,1 @@\n-h\n+H\n--- a/f\n+++ b/f\n@@ -4,2 +4,2 @@\n d\n-e\n+E\n"; string(got) != want {
+		t.Errorf("q2: got\n%s\nwant\n%s", got, want)
+	}
+	if len(p2) != 2 || p2[1] != p[1] {
+		t.Errorf("p2: file only in p was not returned as is")
+	}
+
+	renamed, err := ParseMultiFileDiff([]byte("--- a/e\n+++ b/f\n@@ -1,2 +1,3 @@\n a\n+x\n b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = CommuteMultiFileDiff(renamed, q)
+	var e *ErrConflict
+	if !errors.As(err, &e) || e.Path != "f" {
+		t.Errorf("got error %v, want conflict in f", err)
+	}
+}
@@ -0,0 +1,300 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Compose returns a FileDiff that makes the changes of first followed by
+// those of second, which must apply to the result of first. The hunks are
+// merged line by line using their coordinates, so the files themselves are
+// not needed. If a line of the result of first that second's hunks contain
+// differs from what first's hunks say it is, Compose returns an
+// *ErrContextMismatch.
+//
+// The original file's names and times are taken from first and the new
+// file's from second. Extended headers, which describe each diff on its own,
+// are not carried over.
+func Compose(first, second *FileDiff) (*FileDiff, error) {
+	hunks, err := composeHunks(first.Hunks, second.Hunks, false)
+	if err != nil {
+		return nil, err
+	}
+	return &FileDiff{
+		OrigName:       first.OrigName,
+		OrigTime:       first.OrigTime,
+		OrigTimeLayout: first.OrigTimeLayout,
+		OrigLabel:      first.OrigLabel,
+		NewName:        second.NewName,
+		NewTime:        second.NewTime,
+		NewTimeLayout:  second.NewTimeLayout,
+		NewLabel:       second.NewLabel,
+		Hunks:          hunks,
+		InvalidUTF8:    first.InvalidUTF8 || second.InvalidUTF8,
+	}, nil
+}
+
+// ComposeMultiFileDiff composes two multi-file diffs (see Compose). A file
+// of second is composed with the file of first whose new name is second's
+// original name, so renames in first are followed. Files that are only in
+// one of the diffs are returned as they are: first's files in order, then
+// the files that are only in second.
+func ComposeMultiFileDiff(first, second []*FileDiff) ([]*FileDiff, error) {
+	byPath := make(map[string]*FileDiff, len(second))
+	for _, fd := range second {
+		if p := diffPath(fd.OrigName); p != "" {
+			if _, ok := byPath[p]; !ok {
+				byPath[p] = fd
+			}
+		}
+	}
+
+	var composed []*FileDiff
+	used := make(map[*FileDiff]bool)
+	for _, fd := range first {
+		next := byPath[diffPath(fd.NewName)]
+		if next == nil || used[next] || diffPath(fd.NewName) == "" {
+			composed = append(composed, fd)
+			continue
+		}
+		used[next] = true
+		c, err := Compose(fd, next)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", diffPath(fd.NewName), err)
+		}
+		composed = append(composed, c)
+	}
+	for _, fd := range second {
+		if !used[fd] {
+			composed = append(composed, fd)
+		}
+	}
+	return composed, nil
+}
+
+// devNull is the name of the missing side of an added or deleted file.
+const devNull = "/dev/null"
+
+// diffPath returns the path of a file name from a file header, without the
+// "a/" or "b/" prefix git adds, or "" for /dev/null.
+func diffPath(name string) string {
+	if name == devNull {
+		return ""
+	}
+	if p := strings.TrimPrefix(name, "a/"); p != name {
+		return p
+	}
+	return strings.TrimPrefix(name, "b/")
+}
+
+// ErrContextMismatch is returned by Compose when a line of the file between
+// the two diffs differs in the first and the second diff.
+type ErrContextMismatch struct {
+	// Line is the 1-indexed line number in the file between the diffs.
+	Line int32
+	// First and Second are the line (without its prefix) in each diff.
+	First, Second []byte
+}
+
+func (e *ErrContextMismatch) Error() string {
+	return fmt.Sprintf("line %d of the intermediate file is %q in the first diff but %q in the second", e.Line, e.First, e.Second)
+}
+
+// A composeHunk is a hunk of one of the diffs given to Compose, with its
+// lines and the range of lines of the intermediate file it covers.
+type composeHunk struct {
+	h          *Hunk
+	lines      []hunkLine
+	begin, end int32
+}
+
+// A composeLine is one line of a run of lines of the intermediate file, as
+// one of the diffs has it. op is '=' for a line of the intermediate file
+// that the diff leaves alone, and the op of the hunk line otherwise. The
+// text of a line outside of the diff's hunks is not known.
+type composeLine struct {
+	op    byte
+	text  []byte
+	known bool
+}
+
+// composeHunks composes the hunks of two sequential diffs of a file. If
+// lenient is set, a line of the intermediate file that differs in the two
+// diffs is taken as second has it instead of failing.
+func composeHunks(first, second []*Hunk, lenient bool) ([]*Hunk, error) {
+	fs, err := composeHunksOf(first, false)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := composeHunksOf(second, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var hunks []*Hunk
+	// deltas are how many lines the hunks of each diff before the current
+	// run of lines add, to find the run in the original and new files.
+	var firstDelta, secondDelta int32
+	for len(fs) > 0 || len(ss) > 0 {
+		// Take the overlapping (or adjacent) hunks of both diffs that
+		// start with the hunk that starts first.
+		var cf, cs []composeHunk
+		var lo, hi int32
+		for len(fs) > 0 || len(ss) > 0 {
+			takeFirst := len(ss) == 0 || (len(fs) > 0 && fs[0].begin <= ss[0].begin)
+			next := ss
+			if takeFirst {
+				next = fs
+			}
+			if len(cf)+len(cs) == 0 {
+				lo, hi = next[0].begin, next[0].end
+			} else if next[0].begin > hi {
+				break
+			}
+			if next[0].end > hi {
+				hi = next[0].end
+			}
+			if takeFirst {
+				cf, fs = append(cf, fs[0]), fs[1:]
+			} else {
+				cs, ss = append(cs, ss[0]), ss[1:]
+			}
+		}
+
+		lines, err := composeRun(lo, hi, cf, cs, lenient)
+		if err != nil {
+			return nil, err
+		}
+		lines = tidyChanges(lines)
+		if hasChanges(lines) {
+			section := ""
+			if len(cf) > 0 {
+				section = cf[0].h.Section
+			} else {
+				section = cs[0].h.Section
+			}
+			hunks = append(hunks, buildHunk(lo-firstDelta, lo+secondDelta, section, lines))
+		}
+		for _, c := range cf {
+			firstDelta += c.h.NewLines - c.h.OrigLines
+		}
+		for _, c := range cs {
+			secondDelta += c.h.NewLines - c.h.OrigLines
+		}
+	}
+
+	if anyCRLFLines(first, second) {
+		for _, h := range hunks {
+			recordCRLF(h)
+		}
+	}
+	return hunks, nil
+}
+
+// composeHunksOf splits hunks into lines and finds the lines of the
+// intermediate file they cover, which are the new lines of the first diff
+// and the original lines of the second.
+func composeHunksOf(hunks []*Hunk, second bool) ([]composeHunk, error) {
+	chs := make([]composeHunk, len(hunks))
+	for i, h := range hunks {
+		lines, err := hunkLines(h)
+		if err != nil {
+			return nil, err
+		}
+		begin, n := hunkBegin(h.NewStartLine, h.NewLines), h.NewLines
+		if second {
+			begin, n = hunkBegin(h.OrigStartLine, h.OrigLines), h.OrigLines
+		}
+		if i > 0 && begin < chs[i-1].end {
+			return nil, fmt.Errorf("hunk at line %d overlaps the previous hunk", h.StartPosition)
+		}
+		chs[i] = composeHunk{h: h, lines: lines, begin: begin, end: begin + n}
+	}
+	return chs, nil
+}
+
+// composeRun composes the hunks of both diffs that cover the lines from lo
+// to hi of the intermediate file (see composeHunks for lenient).
+func composeRun(lo, hi int32, first, second []composeHunk, lenient bool) ([]hunkLine, error) {
+	fv := composeView(lo, hi, first, '+')
+	sv := composeView(lo, hi, second, '-')
+
+	var lines []hunkLine
+	line := lo
+	for i, j := 0, 0; i < len(fv) || j < len(sv); {
+		// Lines only in the original file go before the intermediate line
+		// they precede, and lines only in the new file after the ones
+		// they follow.
+		if i < len(fv) && fv[i].op == '-' {
+			lines = append(lines, hunkLine{'-', fv[i].text})
+			i++
+			continue
+		}
+		if j < len(sv) && sv[j].op == '+' {
+			lines = append(lines, hunkLine{'+', sv[j].text})
+			j++
+			continue
+		}
+		if i == len(fv) || j == len(sv) {
+			return nil, fmt.Errorf("hunks covering lines %d to %d of the intermediate file do not match", lo+1, hi)
+		}
+
+		f, s := fv[i], sv[j]
+		text := f.text
+		switch {
+		case f.known && s.known && !bytes.Equal(f.text, s.text):
+			if !lenient {
+				return nil, &ErrContextMismatch{Line: line + 1, First: f.text, Second: s.text}
+			}
+			text = s.text
+		case !f.known:
+			text = s.text
+		}
+		switch {
+		case f.op == '=' && s.op == '=':
+			lines = append(lines, hunkLine{' ', text})
+		case f.op == '=':
+			lines = append(lines, hunkLine{'-', text})
+		case s.op == '=':
+			lines = append(lines, hunkLine{'+', text})
+		default:
+			// Added by the first diff and removed by the second.
+		}
+		i++
+		j++
+		line++
+	}
+	return lines, nil
+}
+
+// composeView returns the lines from lo to hi of the intermediate file as
+// the given hunks of one diff have them, along with the lines that are
+// not in the intermediate file. intermediate is the op of the changed lines
+// that are in the intermediate file ('+' for the first diff, '-' for the
+// second).
+func composeView(lo, hi int32, hunks []composeHunk, intermediate byte) []composeLine {
+	var view []composeLine
+	line := lo
+	for _, c := range hunks {
+		for ; line < c.begin; line++ {
+			view = append(view, composeLine{op: '='})
+		}
+		for _, l := range c.lines {
+			switch l.op {
+			case ' ':
+				view = append(view, composeLine{op: '=', text: l.text, known: true})
+				line++
+			case intermediate:
+				view = append(view, composeLine{op: l.op, text: l.text, known: true})
+				line++
+			default:
+				view = append(view, composeLine{op: l.op, text: l.text})
+			}
+		}
+	}
+	for ; line < hi; line++ {
+		view = append(view, composeLine{op: '='})
+	}
+	return view
+}
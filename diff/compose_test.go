@@ -0,0 +1,139 @@
+package diff
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompose(t *testing.T) {
+	tests := []struct {
+		name          string
+		first, second string
+		want          string
+	}{
+		{
+			name:   "separate",
+			first:  "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			second: "@@ -7,3 +7,3 @@\n g\n-h\n+H\n i\n",
+			want:   "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n@@ -7,3 +7,3 @@\n g\n-h\n+H\n i\n",
+		},
+		{
+			name:   "shifted",
+			first:  "@@ -1,2 +1,4 @@\n a\n+x\n+y\n b\n",
+			second: "@@ -9,3 +9,3 @@\n g\n-h\n+H\n i\n",
+			want:   "@@ -1,2 +1,4 @@\n a\n+x\n+y\n b\n@@ -7,3 +9,3 @@\n g\n-h\n+H\n i\n",
+		},
+		{
+			name:   "overlapping",
+			first:  "@@ -1,3 +1,4 @@\n a\n-b\n+B\n+X\n c\n",
+			second: "@@ -2,3 +2,2 @@\n B\n-X\n-c\n+C\n",
+			want:   "@@ -1,3 +1,3 @@\n a\n-b\n-c\n+B\n+C\n",
+		},
+		{
+			name:   "undone",
+			first:  "@@ -1,2 +1,3 @@\n a\n+x\n b\n",
+			second: "@@ -1,3 +1,2 @@\n a\n-x\n b\n",
+			want:   "",
+		},
+		{
+			name:   "no newline",
+			first:  "@@ -1,2 +1,2 @@\n a\n-b\n+c\n\\ No newline at end of file\n",
+			second: "@@ -1,2 +1,3 @@\n a\n-c\n\\ No newline at end of file\n+c\n+d\n",
+			want:   "@@ -1,2 +1,3 @@\n a\n-b\n+c\n+d\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			first, err := ParseHunks([]byte(test.first))
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := ParseHunks([]byte(test.second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fd, err := Compose(&FileDiff{Hunks: first}, &FileDiff{Hunks: second})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := PrintHunks(fd.Hunks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCompose_mismatch(t *testing.T) {
+	first, err := ParseHunks([]byte("@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ParseHunks([]byte("@@ -2,2 +2,2 @@\n-Y\n+Z\n c\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Compose(&FileDiff{Hunks: first}, &FileDiff{Hunks: second})
+	var e *ErrContextMismatch
+	if !errors.As(err, &e) {
+		t.Fatalf("got error %v, want *ErrContextMismatch", err)
+	}
+	if e.Line != 2 || string(e.First) != "B\n" || string(e.Second) != "Y\n" {
+		t.Errorf("got %+v", e)
+	}
+}
+
+func TestComposeMultiFileDiff(t *testing.T) {
+	first, err := ParseMultiFileDiff([]byte(`diff --git a/old b/new
+similarity index 90%
+rename from old
+rename to new
+--- a/old
++++ b/new
+@@ -1,2 +1,2 @@
+-a
++A
+ b
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ParseMultiFileDiff([]byte(`--- a/new
++++ b/new
+@@ -1,2 +1,2 @@
+ A
+-b
++B
+--- a/other
++++ b/other
+@@ -1 +1 @@
+-x
++y
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fds, err := ComposeMultiFileDiff(first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fds) != 2 {
+		t.Fatalf("got %d files, want 2", len(fds))
+	}
+	if fds[0].OrigName != "a/old" || fds[0].NewName != "b/new" {
+		t.Errorf("got names %q and %q", fds[0].OrigName, fds[0].NewName)
+	}
+	got, err := PrintHunks(fds[0].Hunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "@@ -1,2 +1,2 @@\n-a\n-b\n+A\n+B\n"; string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if fds[1] != second[1] {
+		t.Errorf("file only in second diff was not returned as is")
+	}
+}
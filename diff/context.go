@@ -0,0 +1,100 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ShrinkContext returns a copy of d whose hunks have at most n context
+// lines around each change, as with "diff -U n". Hunks are split where
+// more than 2*n context lines separate their changes. ShrinkContext cannot
+// add context lines; see ExpandContext for that.
+func ShrinkContext(d *FileDiff, n int) (*FileDiff, error) {
+	if n < 0 {
+		n = 0
+	}
+	changes, err := hunkChanges(d.Hunks)
+	if err != nil {
+		return nil, err
+	}
+	for i := range changes {
+		changes[i].before = lastN(changes[i].before, int32(n))
+		changes[i].after = firstN(changes[i].after, int32(n))
+	}
+	return withContext(d, changes), nil
+}
+
+// ExpandContext returns a copy of d whose hunks have n context lines
+// around each change (fewer at the start and end of the file), taken from
+// orig, the contents of the original file d applies to. Hunks are merged
+// or split as needed. If n is negative, the result has a single hunk with
+// the whole file as context.
+//
+// ExpandContext returns an error if the lines d removes or its context
+// lines are not in orig where d says they are, or if a hunk is past the end
+// of orig.
+func ExpandContext(d *FileDiff, orig []byte, n int) (*FileDiff, error) {
+	lines := splitLines(orig)
+	if n < 0 {
+		n = len(lines)
+	}
+	if err := checkOrig(d.Hunks, lines); err != nil {
+		return nil, err
+	}
+	changes, err := hunkChanges(d.Hunks)
+	if err != nil {
+		return nil, err
+	}
+	for i := range changes {
+		c := &changes[i]
+		// The context lines reach up to the previous and next changes.
+		var prevEnd int32
+		if i > 0 {
+			prevEnd = changes[i-1].orig + changes[i-1].origLines()
+		}
+		nextStart := int32(len(lines))
+		if i < len(changes)-1 {
+			nextStart = changes[i+1].orig
+		}
+		if end := c.orig + c.origLines(); c.orig < prevEnd || end > int32(len(lines)) {
+			return nil, fmt.Errorf("hunk ending at line %d of the original file overlaps the hunk before it or is past the end of the file (%d lines)", end, len(lines))
+		}
+		c.before = lastN(lines[prevEnd:c.orig], int32(n))
+		c.after = firstN(lines[c.orig+c.origLines():nextStart], int32(n))
+	}
+	return withContext(d, changes), nil
+}
+
+// checkOrig checks that the original lines of hunks are the lines of the
+// original file at the same positions.
+func checkOrig(hunks []*Hunk, orig [][]byte) error {
+	for _, h := range hunks {
+		lines, err := hunkLines(h)
+		if err != nil {
+			return err
+		}
+		pos := hunkBegin(h.OrigStartLine, h.OrigLines)
+		for _, l := range lines {
+			if l.op == '+' {
+				continue
+			}
+			if pos < 0 || int(pos) >= len(orig) || !bytes.Equal(orig[pos], l.text) {
+				return fmt.Errorf("line %d of the original file does not match the diff", pos+1)
+			}
+			pos++
+		}
+	}
+	return nil
+}
+
+// withContext returns a copy of d with the hunks made of changes.
+func withContext(d *FileDiff, changes []change) *FileDiff {
+	c := *d
+	c.Hunks = joinChanges(changes)
+	if anyCRLFLines(d.Hunks) {
+		for _, h := range c.Hunks {
+			recordCRLF(h)
+		}
+	}
+	return &c
+}
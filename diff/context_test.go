@@ -0,0 +1,74 @@
+package diff
+
+import "testing"
+
+func TestShrinkContext(t *testing.T) {
+	const hunks = "@@ -1,9 +1,9 @@\n a\n b\n c\n-d\n+D\n e\n f\n g\n-h\n+H\n i\n"
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{n: 3, want: hunks},
+		{n: 2, want: "@@ -2,8 +2,8 @@\n b\n c\n-d\n+D\n e\n f\n g\n-h\n+H\n i\n"},
+		{n: 1, want: "@@ -3,3 +3,3 @@\n c\n-d\n+D\n e\n@@ -7,3 +7,3 @@\n g\n-h\n+H\n i\n"},
+		{n: 0, want: "@@ -4,1 +4,1 @@\n-d\n+D\n@@ -8,1 +8,1 @@\n-h\n+H\n"},
+	}
+	in, err := ParseHunks([]byte(hunks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		fd, err := ShrinkContext(&FileDiff{Hunks: in}, test.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := PrintHunks(fd.Hunks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.want {
+			t.Errorf("%d: got\n%s\nwant\n%s", test.n, got, test.want)
+		}
+	}
+}
+
+func TestExpandContext(t *testing.T) {
+	const orig = "a\nb\nc\nd\ne\nf\ng\nh\ni"
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{n: 2, want: "@@ -2,5 +2,5 @@\n b\n c\n-d\n+D\n e\n f\n"},
+		{n: 5, want: "@@ -1,9 +1,9 @@\n a\n b\n c\n-d\n+D\n e\n f\n g\n h\n i\n\\ No newline at end of file\n"},
+		{n: -1, want: "@@ -1,9 +1,9 @@\n a\n b\n c\n-d\n+D\n e\n f\n g\n h\n i\n\\ No newline at end of file\n"},
+	}
+	in, err := ParseHunks([]byte("@@ -3,3 +3,3 @@\n c\n-d\n+D\n e\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		fd, err := ExpandContext(&FileDiff{Hunks: in}, []byte(orig), test.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := PrintHunks(fd.Hunks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.want {
+			t.Errorf("%d: got\n%s\nwant\n%s", test.n, got, test.want)
+		}
+	}
+
+	if _, err := ExpandContext(&FileDiff{Hunks: in}, []byte("a\nb\nc\nx\n"), 3); err == nil {
+		t.Error("got no error expanding with the wrong original file")
+	}
+
+	past, err := ParseHunks([]byte("@@ -10,0 +11,1 @@\n+x\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExpandContext(&FileDiff{Hunks: past}, []byte("a\nb\nc\n"), 3); err == nil {
+		t.Error("got no error expanding a hunk past the end of the original file")
+	}
+}
@@ -9,6 +9,46 @@ import (
 type ParseOptions struct {
 	// KeepCR specifies whether to keep trailing carriage return characters (\r) in lines.
 	KeepCR bool
+
+	// TimeLayouts are the time.Parse layouts tried, in order, for the
+	// timestamp that may follow the file name in a file header. If nil,
+	// DefaultTimeLayouts is used.
+	TimeLayouts []string
+
+	// StripANSI specifies whether to remove ANSI SGR color escape sequences
+	// (as written by `git diff --color`) from every line before parsing.
+	StripANSI bool
+
+	// KeepColorSpans specifies whether to record the color escape sequences
+	// removed from hunk bodies in Hunk.ColorSpans. It implies StripANSI.
+	KeepColorSpans bool
+
+	// Limits for parsing untrusted input. Zero means no limit. Exceeding a
+	// limit stops parsing with the corresponding error (possibly wrapped
+	// in a ParseError).
+
+	// MaxLineBytes is the maximum length of a line, excluding its newline
+	// (ErrLineTooLong).
+	MaxLineBytes int
+	// MaxHunkBytes is the maximum size of a hunk body (ErrHunkTooLarge).
+	MaxHunkBytes int
+	// MaxFiles is the maximum number of files in a multi-file diff
+	// (ErrTooManyFiles).
+	MaxFiles int
+	// MaxHunksPerFile is the maximum number of hunks in a file diff
+	// (ErrTooManyHunks).
+	MaxHunksPerFile int
+	// MaxTotalBytes is the maximum number of bytes read from the input
+	// (ErrInputTooLarge).
+	MaxTotalBytes int64
+
+	// Encoding is the character encoding of the input, which is transcoded
+	// to UTF-8 before parsing. The zero value reads the input as is.
+	Encoding Encoding
+
+	// Parallelism is the number of goroutines ParseMultiFileDiffParallel
+	// parses with. If zero, runtime.GOMAXPROCS(0) is used.
+	Parallelism int
 }
 
 // A FileDiff represents a unified diff for a single file.
@@ -18,20 +58,69 @@ type ParseOptions struct {
 //	--- oldname	2009-10-11 15:12:20.000000000 -0700
 //	+++ newname	2009-10-11 15:12:30.000000000 -0700
 type FileDiff struct {
+	// what this FileDiff represents (a unified diff or one of the
+	// messages printed by diff -r)
+	Kind FileDiffKind
 	// the original name of the file
 	OrigName string
 	// the original timestamp (nil if not present)
 	OrigTime *time.Time
+	// the layout OrigTime was written in, used again when printing (empty
+	// means the GNU diff layout, "2006-01-02 15:04:05.000000000 -0700")
+	OrigTimeLayout string
+	// text following the original name that is not a timestamp (e.g.,
+	// Subversion's "(revision 123)")
+	OrigLabel string
 	// the new name of the file (often same as OrigName)
 	NewName string
 	// the new timestamp (nil if not present)
 	NewTime *time.Time
+	// the layout NewTime was written in (see OrigTimeLayout)
+	NewTimeLayout string
+	// text following the new name that is not a timestamp (see OrigLabel)
+	NewLabel string
+	// non-diff lines that preceded this file's diff (e.g., a commit message,
+	// an "Index:" banner or log output)
+	Preamble []string
 	// extended header lines (e.g., git's "new mode <mode>", "rename from <path>", etc.)
 	Extended []string
 	// hunks that were changed from orig to new
 	Hunks []*Hunk
+	// whether the body of any hunk is not valid UTF-8 (e.g., a file in a
+	// legacy encoding), so it must be escaped before being displayed
+	InvalidUTF8 bool
+	// per-file summary read from `git diff --raw`, `--numstat` or `--stat`
+	// output (nil for unified diffs)
+	Summary *FileSummary
 }
 
+// A FileDiffKind describes what a FileDiff represents. Besides unified
+// diffs, recursive diffs (diff -r) print one-line messages about files that
+// are only present on one side or that cannot be compared line by line.
+// Paths in these messages are always slash-separated.
+type FileDiffKind int
+
+const (
+	// KindUnified is a unified diff with file headers and hunks.
+	KindUnified FileDiffKind = iota
+
+	// KindOnlyIn is an "Only in {dir}: {name}" message. OrigName is the
+	// joined path and NewName is empty.
+	KindOnlyIn
+
+	// KindCommonSubdirectories is a "Common subdirectories: {orig} and
+	// {new}" message, printed for directories present on both sides.
+	KindCommonSubdirectories
+
+	// KindFilesDiffer is a "Files {orig} and {new} differ" message, as
+	// printed by diff -q.
+	KindFilesDiffer
+
+	// KindBinaryFilesDiffer is a "Binary files {orig} and {new} differ"
+	// message outside of a git diff's extended headers.
+	KindBinaryFilesDiffer
+)
+
 // A Hunk represents a series of changes (additions or deletions) in a file's
 // unified diff.
 type Hunk struct {
@@ -54,6 +143,23 @@ type Hunk struct {
 	StartPosition int32
 	// hunk body (lines prefixed with '-', '+', or ' ')
 	Body []byte
+	// color escape sequences removed from Body, in order (only set when
+	// parsing with ParseOptions.KeepColorSpans)
+	ColorSpans []ColorSpan
+	// 0-indexed numbers of the body lines that ended in "\r\n" in the
+	// input but are stored in Body ending in "\n" (only set when parsing
+	// without ParseOptions.KeepCR; see LineEndings)
+	CRLFLines []int32
+}
+
+// A ColorSpan is an ANSI SGR escape sequence (e.g., "\x1b[31m") that was
+// removed from a colored diff. Each sequence applies from its offset until
+// the next one.
+type ColorSpan struct {
+	// byte offset in the hunk body at which the sequence appeared
+	Offset int32
+	// the complete escape sequence
+	Code string
 }
 
 // A Stat is a diff stat that represents the number of lines added/changed/deleted.
@@ -67,8 +173,12 @@ type Stat struct {
 }
 
 // Stat computes the number of lines added/changed/deleted in all
-// hunks in this file's diff.
+// hunks in this file's diff. If the FileDiff was read from summary output
+// and has no hunks, it returns the summary's line counts.
 func (d *FileDiff) Stat() Stat {
+	if d.Hunks == nil && d.Summary != nil && d.Summary.Stat != nil {
+		return *d.Summary.Stat
+	}
 	total := Stat{}
 	for _, h := range d.Hunks {
 		total.add(h.Stat())
@@ -77,17 +187,16 @@ func (d *FileDiff) Stat() Stat {
 }
 
 // Stat computes the number of lines added/changed/deleted in this
-// hunk.
+// hunk. It is not cached: each call counts the lines of Body.
 func (h *Hunk) Stat() Stat {
-	lines := bytes.Split(h.Body, []byte{'\n'})
 	var last byte
 	st := Stat{}
-	for _, line := range lines {
-		if len(line) == 0 {
-			last = 0
-			continue
+	for body := h.Body; ; {
+		var first byte
+		if len(body) > 0 {
+			first = body[0]
 		}
-		switch line[0] {
+		switch first {
 		case '-':
 			if last == '+' {
 				st.Added--
@@ -95,7 +204,7 @@ func (h *Hunk) Stat() Stat {
 				last = 0 // next line can't change this one since this is already a change
 			} else {
 				st.Deleted++
-				last = line[0]
+				last = first
 			}
 		case '+':
 			if last == '-' {
@@ -104,11 +213,16 @@ func (h *Hunk) Stat() Stat {
 				last = 0 // next line can't change this one since this is already a change
 			} else {
 				st.Added++
-				last = line[0]
+				last = first
 			}
 		default:
 			last = 0
 		}
+		i := bytes.IndexByte(body, '\n')
+		if i < 0 {
+			break
+		}
+		body = body[i+1:]
 	}
 	return st
 }
@@ -121,14 +235,39 @@ var (
 const hunkHeader = "@@ -%d,%d +%d,%d @@"
 const onlyInMessage = "Only in %s: %s\n"
 
-// diffTimeParseLayout is the layout used to parse the time in unified diff file
-// header timestamps.
-// See https://www.gnu.org/software/diffutils/manual/html_node/Detailed-Unified.html.
-const diffTimeParseLayout = "2006-01-02 15:04:05 -0700"
+const (
+	commonSubdirectoriesPrefix = "Common subdirectories: "
+	filesPrefix                = "Files "
+	binaryFilesPrefix          = "Binary files "
+	differSuffix               = " differ"
+)
+
+// DefaultTimeLayouts are the layouts tried when parsing file header
+// timestamps if ParseOptions.TimeLayouts is nil.
+var DefaultTimeLayouts = []string{
+	// GNU diff.
+	// See https://www.gnu.org/software/diffutils/manual/html_node/Detailed-Unified.html.
+	diffTimeFormatLayout,
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05.000000 -0700",
+
+	// Apple's diff is based on freebsd diff, which uses a timestamp format
+	// that does not include the timezone offset.
+	"2006-01-02 15:04:05",
 
-// Apple's diff is based on freebsd diff, which uses a timestamp format that does
-// not include the timezone offset.
-const diffTimeParseWithoutTZLayout = "2006-01-02 15:04:05"
+	// Textual time zone names. A name is only accepted if time.Parse knows
+	// its offset (UTC, GMT and the local time zone's names); a header with
+	// any other name is kept as a label.
+	"2006-01-02 15:04:05.000000000 MST",
+	"2006-01-02 15:04:05 MST",
+
+	// Traditional ctime(3) style, as used by diff -c and older diffs.
+	"Mon Jan _2 15:04:05 2006",
+	time.UnixDate,
+
+	// RCS.
+	"2006/01/02 15:04:05",
+}
 
 // diffTimeFormatLayout is the layout used to format (i.e., print) the time in unified diff file
 // header timestamps.
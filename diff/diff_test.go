@@ -2,6 +2,8 @@ package diff
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"github.com/google/go-cmp/cmp"
 	"io"
 	"io/ioutil"
@@ -117,10 +119,12 @@ func TestParseFileDiffHeaders(t *testing.T) {
 		{
 			filename: "sample_file_no_fractional_seconds.diff",
 			wantDiff: &FileDiff{
-				OrigName: "goyaml.go",
-				OrigTime: unix(1322164040), // 2011-11-24 19:47:20
-				NewName:  "goyaml.go",
-				NewTime:  unix(1322486679), // 2011-11-28 13:24:39
+				OrigName:       "goyaml.go",
+				OrigTime:       unix(1322164040), // 2011-11-24 19:47:20
+				OrigTimeLayout: "2006-01-02 15:04:05 -0700",
+				NewName:        "goyaml.go",
+				NewTime:        unix(1322486679), // 2011-11-28 13:24:39
+				NewTimeLayout:  "2006-01-02 15:04:05 -0700",
 			},
 		},
 		{
@@ -596,6 +600,7 @@ func TestParseMultiFileDiffHeaders(t *testing.T) {
 					},
 				},
 				{
+					Kind:     KindOnlyIn,
 					OrigName: "source_a/file_2.txt",
 					OrigTime: nil,
 					NewName:  "",
@@ -603,6 +608,7 @@ func TestParseMultiFileDiffHeaders(t *testing.T) {
 					Extended: nil,
 				},
 				{
+					Kind:     KindOnlyIn,
 					OrigName: "source_b/file_3.txt",
 					OrigTime: nil,
 					NewName:  "",
@@ -615,6 +621,7 @@ func TestParseMultiFileDiffHeaders(t *testing.T) {
 			filename: "sample_contains_only_added_deleted_files.diff",
 			wantDiffs: []*FileDiff{
 				{
+					Kind:     KindOnlyIn,
 					OrigName: "source_a/file_1.txt",
 					OrigTime: nil,
 					NewName:  "",
@@ -622,6 +629,7 @@ func TestParseMultiFileDiffHeaders(t *testing.T) {
 					Extended: nil,
 				},
 				{
+					Kind:     KindOnlyIn,
 					OrigName: "source_a/file_2.txt",
 					OrigTime: nil,
 					NewName:  "",
@@ -629,6 +637,7 @@ func TestParseMultiFileDiffHeaders(t *testing.T) {
 					Extended: nil,
 				},
 				{
+					Kind:     KindOnlyIn,
 					OrigName: "source_b/file_3.txt",
 					OrigTime: nil,
 					NewName:  "",
@@ -650,15 +659,17 @@ func TestParseMultiFileDiffHeaders(t *testing.T) {
 					},
 				},
 				{
+					Kind:     KindOnlyIn,
 					OrigName: "source_a/file_2.txt",
 					OrigTime: nil,
 					NewName:  "",
 					NewTime:  nil,
-					Extended: []string{
+					Preamble: []string{
 						"Only in universe!",
 					},
 				},
 				{
+					Kind:     KindOnlyIn,
 					OrigName: "source_b/file_3.txt some unrelated stuff here.",
 					OrigTime: nil,
 					NewName:  "",
@@ -666,6 +677,7 @@ func TestParseMultiFileDiffHeaders(t *testing.T) {
 					Extended: nil,
 				},
 				{
+					Kind:     KindOnlyIn,
 					OrigName: "source_b/file_3.txt",
 					OrigTime: nil,
 					NewName:  "",
@@ -674,10 +686,47 @@ func TestParseMultiFileDiffHeaders(t *testing.T) {
 				},
 			},
 		},
+		{
+			filename: "sample_recursive.diff",
+			wantDiffs: []*FileDiff{
+				{
+					Kind:     KindCommonSubdirectories,
+					OrigName: "a/docs",
+					NewName:  "b/docs",
+				},
+				{
+					OrigName: "a/file_1.txt",
+					NewName:  "b/file_1.txt",
+					Extended: []string{
+						"diff -r a/file_1.txt b/file_1.txt",
+					},
+				},
+				{
+					Kind:     KindBinaryFilesDiffer,
+					OrigName: "a/image.png",
+					NewName:  "b/image.png",
+				},
+				{
+					Kind:     KindOnlyIn,
+					OrigName: "a/docs/old.md",
+				},
+				{
+					Kind:     KindFilesDiffer,
+					OrigName: "a/rock and roll.txt",
+					NewName:  "b/rock and roll.txt",
+				},
+				{
+					Kind:     KindCommonSubdirectories,
+					OrigName: "a/src",
+					NewName:  "b/src",
+				},
+			},
+		},
 		{
 			filename: "sample_onlyin_complex_filenames.diff",
 			wantDiffs: []*FileDiff{
 				{
+					Kind:     KindOnlyIn,
 					OrigName: "internal/trace/foo bar/bam",
 					OrigTime: nil,
 					NewName:  "",
@@ -685,6 +734,7 @@ func TestParseMultiFileDiffHeaders(t *testing.T) {
 					Extended: nil,
 				},
 				{
+					Kind:     KindOnlyIn,
 					OrigName: "internal/trace/foo bar/bam: bar",
 					OrigTime: nil,
 					NewName:  "",
@@ -692,6 +742,7 @@ func TestParseMultiFileDiffHeaders(t *testing.T) {
 					Extended: nil,
 				},
 				{
+					Kind:     KindOnlyIn,
 					OrigName: "internal/trace/hello/world: bazz",
 					OrigTime: nil,
 					NewName:  "",
@@ -868,6 +919,8 @@ func TestParseFileDiffAndPrintFileDiff(t *testing.T) {
 		{filename: "sample_file_extended_empty_deleted_binary.diff"},
 		{filename: "sample_file_extended_empty_rename.diff"},
 		{filename: "sample_file_extended_empty_binary.diff"},
+		{filename: "sample_file_labels.diff"},
+		{filename: "sample_file_ctime.diff"},
 		{
 			filename:     "empty.diff",
 			wantParseErr: &ParseError{0, 0, ErrExtendedHeadersEOF},
@@ -906,7 +959,7 @@ func TestParseMultiFileDiffAndPrintMultiFileDiff(t *testing.T) {
 	}{
 		{filename: "sample_multi_file.diff", wantFileDiffs: 2},
 		{filename: "sample_multi_file_single.diff", wantFileDiffs: 1},
-		{filename: "sample_multi_file_single_apple_in.diff", wantFileDiffs: 1, wantOutFileName: "sample_multi_file_single_apple_out.diff"},
+		{filename: "sample_multi_file_single_apple_in.diff", wantFileDiffs: 1},
 		{filename: "sample_multi_file_new.diff", wantFileDiffs: 3},
 		{filename: "sample_multi_file_deleted.diff", wantFileDiffs: 3},
 		{filename: "sample_multi_file_rename.diff", wantFileDiffs: 3},
@@ -918,6 +971,7 @@ func TestParseMultiFileDiffAndPrintMultiFileDiff(t *testing.T) {
 		{filename: "sample_contains_only_added_deleted_files.diff", wantFileDiffs: 3},
 		{filename: "sample_onlyin_line_isnt_a_file_header.diff", wantFileDiffs: 4},
 		{filename: "sample_onlyin_complex_filenames.diff", wantFileDiffs: 3},
+		{filename: "sample_recursive.diff", wantFileDiffs: 6},
 		{filename: "sample_multi_file_minuses_pluses.diff", wantFileDiffs: 2},
 		{filename: "sample_multi_file_without_extended.diff", wantFileDiffs: 2},
 	}
@@ -955,6 +1009,213 @@ func TestParseMultiFileDiffAndPrintMultiFileDiff(t *testing.T) {
 	}
 }
 
+func TestParseFileDiffTimestamps(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		opts       ParseOptions
+		wantTime   *time.Time
+		wantLayout string
+		wantLabel  string
+	}{
+		{
+			name:     "gnu",
+			header:   "2009-10-11 15:12:20.000000000 -0700",
+			wantTime: unix(1255299140),
+		},
+		{
+			name:       "microseconds",
+			header:     "2009-10-11 15:12:20.123456 -0700",
+			wantTime:   func() *time.Time { t := time.Unix(1255299140, 123456000); return &t }(),
+			wantLayout: "2006-01-02 15:04:05.000000 -0700",
+		},
+		{
+			name:       "rcs",
+			header:     "2009/10/11 15:12:20",
+			wantTime:   unix(1255273940),
+			wantLayout: "2006/01/02 15:04:05",
+		},
+		{
+			name:       "zone name",
+			header:     "2009-10-11 15:12:20 UTC",
+			wantTime:   unix(1255273940),
+			wantLayout: "2006-01-02 15:04:05 MST",
+		},
+		{
+			name:      "unknown zone name",
+			header:    "2009-10-11 15:12:20 XYZ",
+			wantLabel: "2009-10-11 15:12:20 XYZ",
+		},
+		{
+			name:      "label",
+			header:    "(revision 1234)",
+			wantLabel: "(revision 1234)",
+		},
+		{
+			name:       "custom layout",
+			header:     "11.10.2009 15:12",
+			opts:       ParseOptions{TimeLayouts: []string{"02.01.2006 15:04"}},
+			wantTime:   unix(1255273920),
+			wantLayout: "02.01.2006 15:04",
+		},
+		{
+			name:      "custom layouts replace defaults",
+			header:    "2009-10-11 15:12:20.000000000 -0700",
+			opts:      ParseOptions{TimeLayouts: []string{"02.01.2006 15:04"}},
+			wantLabel: "2009-10-11 15:12:20.000000000 -0700",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := "--- a\t" + test.header + "\n+++ b\t" + test.header + "\n@@ -1,1 +1,1 @@\n-x\n+y\n"
+			fd, err := ParseFileDiffOptions([]byte(input), test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(fd.OrigTime, test.wantTime) {
+				t.Errorf("got OrigTime %v, want %v", fd.OrigTime, test.wantTime)
+			}
+			if fd.OrigTimeLayout != test.wantLayout || fd.NewTimeLayout != test.wantLayout {
+				t.Errorf("got layouts %q and %q, want %q", fd.OrigTimeLayout, fd.NewTimeLayout, test.wantLayout)
+			}
+			if fd.OrigLabel != test.wantLabel || fd.NewLabel != test.wantLabel {
+				t.Errorf("got labels %q and %q, want %q", fd.OrigLabel, fd.NewLabel, test.wantLabel)
+			}
+
+			printed, err := PrintFileDiff(fd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(printed) != input {
+				t.Errorf("printed file diff != original file diff\n\n# PrintFileDiff output - Original:\n%s", cmp.Diff(input, string(printed)))
+			}
+		})
+	}
+}
+
+func TestParseFileDiffTimestampZoneName(t *testing.T) {
+	// PDT is only known where it is the local time zone; elsewhere it must
+	// not be taken as UTC.
+	const header = "2009-10-11 15:12:20 PDT"
+	fd, err := ParseFileDiff([]byte("--- a\t" + header + "\n+++ b\t" + header + "\n@@ -1,1 +1,1 @@\n-x\n+y\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fd.OrigTime == nil {
+		if fd.OrigLabel != header {
+			t.Errorf("got OrigLabel %q, want %q", fd.OrigLabel, header)
+		}
+	} else if want := time.Unix(1255299140, 0); !fd.OrigTime.Equal(want) {
+		t.Errorf("got OrigTime %v, want %v", fd.OrigTime, want)
+	}
+}
+
+func TestPrintFileDiffDefaultTimeLayout(t *testing.T) {
+	diffData, err := ioutil.ReadFile(filepath.Join("testdata", "sample_multi_file_single_apple_in.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(filepath.Join("testdata", "sample_multi_file_single_apple_out.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := ParseMultiFileDiff(diffData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range diffs {
+		// Timestamps are printed in the GNU diff layout when the
+		// original layout is unknown.
+		d.OrigTimeLayout, d.NewTimeLayout = "", ""
+	}
+	printed, err := PrintMultiFileDiff(diffs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(printed, want) {
+		t.Errorf("printed multi-file diff != expected\n\n# PrintMultiFileDiff output - Expected:\n%s", cmp.Diff(want, printed))
+	}
+}
+
+func TestParseMultiFileDiff_StripANSI(t *testing.T) {
+	colored, err := ioutil.ReadFile(filepath.Join("testdata", "sample_color.ansi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := ioutil.ReadFile(filepath.Join("testdata", "sample_color_stripped.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := ParseMultiFileDiff(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ParseMultiFileDiffOptions(colored, ParseOptions{StripANSI: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("got - want:\n%s", cmp.Diff(want, got))
+	}
+
+	got, err = ParseMultiFileDiffOptions(colored, ParseOptions{KeepColorSpans: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || len(got[0].Hunks) != 1 {
+		t.Fatalf("got %d file diffs, want 1 with 1 hunk", len(got))
+	}
+	h := got[0].Hunks[0]
+	if !bytes.Equal(h.Body, want[0].Hunks[0].Body) {
+		t.Errorf("got body %q, want %q", h.Body, want[0].Hunks[0].Body)
+	}
+	wantSpans := []ColorSpan{
+		{Offset: 0, Code: "\x1b[31m"},
+		{Offset: 12, Code: "\x1b[m"},
+		{Offset: 13, Code: "\x1b[32m"},
+		{Offset: 14, Code: "\x1b[m"},
+		{Offset: 14, Code: "\x1b[32m"},
+		{Offset: 25, Code: "\x1b[m"},
+	}
+	if !cmp.Equal(h.ColorSpans[:len(wantSpans)], wantSpans) {
+		t.Errorf("got - want color spans:\n%s", cmp.Diff(wantSpans, h.ColorSpans[:len(wantSpans)]))
+	}
+}
+
+func TestParseMultiFileDiff_Limits(t *testing.T) {
+	diffData, err := ioutil.ReadFile(filepath.Join("testdata", "sample_multi_file.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		opts    ParseOptions
+		wantErr error
+	}{
+		"within limits": {
+			opts: ParseOptions{MaxLineBytes: 100, MaxHunkBytes: 1000, MaxFiles: 2, MaxHunksPerFile: 2, MaxTotalBytes: int64(len(diffData))},
+		},
+		"line":       {opts: ParseOptions{MaxLineBytes: 20}, wantErr: ErrLineTooLong},
+		"hunk":       {opts: ParseOptions{MaxHunkBytes: 100}, wantErr: ErrHunkTooLarge},
+		"files":      {opts: ParseOptions{MaxFiles: 1}, wantErr: ErrTooManyFiles},
+		"hunks":      {opts: ParseOptions{MaxHunksPerFile: 1}, wantErr: ErrTooManyHunks},
+		"total size": {opts: ParseOptions{MaxTotalBytes: int64(len(diffData)) - 1}, wantErr: ErrInputTooLarge},
+	}
+	for label, test := range tests {
+		diffs, err := ParseMultiFileDiffOptions(diffData, test.opts)
+		if test.wantErr == nil {
+			if err != nil || len(diffs) != 2 {
+				t.Errorf("%s: got %d file diffs and err %v, want 2 file diffs", label, len(diffs), err)
+			}
+			continue
+		}
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: got err %v, want %v", label, err, test.wantErr)
+		}
+	}
+}
+
 func TestParseMultiFileDiffAndPrintMultiFileDiffIncludingTrailingContent(t *testing.T) {
 	testInput, err := ioutil.ReadFile(filepath.Join("testdata", "sample_multi_file_trailing_content.diff"))
 	if err != nil {
@@ -1001,6 +1262,146 @@ func TestParseMultiFileDiffAndPrintMultiFileDiffIncludingTrailingContent(t *test
 	}
 }
 
+func TestParseMultiFileDiffPreambleAndEpilogue(t *testing.T) {
+	input := `From 1234 Mon Sep 17 00:00:00 2001
+Subject: [PATCH] Add files
+
+Commit message.
+diff --git a/a.txt b/a.txt
+new file mode 100644
+index 0000000..e69de29
+Index: b.txt
+===================================================================
+--- b.txt
++++ b.txt
+@@ -1,1 +1,1 @@
+-x
++y
+CI step finished
+diff --git a/c.txt b/c.txt
+index 1234567..89abcde 100644
+--- a/c.txt
++++ b/c.txt
+@@ -1,1 +1,1 @@
+-x
++y
+-- 
+2.30.0
+`
+	r := NewMultiFileDiffReader(strings.NewReader(input))
+	diffs, err := r.ReadAllFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2][]string{
+		{{"From 1234 Mon Sep 17 00:00:00 2001", "Subject: [PATCH] Add files", "", "Commit message."}, {"diff --git a/a.txt b/a.txt", "new file mode 100644", "index 0000000..e69de29"}},
+		{{"Index: b.txt", "==================================================================="}, nil},
+		{{"CI step finished"}, {"diff --git a/c.txt b/c.txt", "index 1234567..89abcde 100644"}},
+	}
+	if len(diffs) != len(want) {
+		t.Fatalf("got %d file diffs, want %d", len(diffs), len(want))
+	}
+	for i, d := range diffs {
+		if !cmp.Equal(d.Preamble, want[i][0]) {
+			t.Errorf("file %d: got - want preamble:\n%s", i, cmp.Diff(want[i][0], d.Preamble))
+		}
+		if !cmp.Equal(d.Extended, want[i][1]) {
+			t.Errorf("file %d: got - want extended headers:\n%s", i, cmp.Diff(want[i][1], d.Extended))
+		}
+	}
+	if diffs[0].NewName != "b/a.txt" {
+		t.Errorf("got NewName %q for empty new file after preamble, want %q", diffs[0].NewName, "b/a.txt")
+	}
+
+	// The "-- " signature separator is indistinguishable from a removed
+	// line, so only the version line is trailing content.
+	if got, want := r.Epilogue(), []string{"2.30.0"}; !cmp.Equal(got, want) {
+		t.Errorf("got - want epilogue:\n%s", cmp.Diff(want, got))
+	}
+
+	printed, err := PrintMultiFileDiff(diffs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.TrimSuffix(input, "2.30.0\n"); string(printed) != want {
+		t.Errorf("printed multi-file diff != original multi-file diff\n\n# PrintMultiFileDiff output - Original:\n%s", cmp.Diff(want, string(printed)))
+	}
+}
+
+func TestParseMultiFileDiffCombinedExtendedHeaders(t *testing.T) {
+	input := `diff --git a/run.sh b/run.sh
+mode 100644,100644..100755
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644,100644
+index 1234567,89abcde..0000000
+--- a/gone.txt
++++ /dev/null
+@@ -1,1 +0,0 @@
+-x
+`
+	diffs, err := ParseMultiFileDiffOptions([]byte(input), ParseOptions{MaxLineBytes: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"diff --git a/run.sh b/run.sh", "mode 100644,100644..100755"},
+		{"diff --git a/gone.txt b/gone.txt", "deleted file mode 100644,100644", "index 1234567,89abcde..0000000"},
+	}
+	if len(diffs) != len(want) {
+		t.Fatalf("got %d file diffs, want %d", len(diffs), len(want))
+	}
+	for i, d := range diffs {
+		if d.Preamble != nil {
+			t.Errorf("file %d: got preamble %q, want none", i, d.Preamble)
+		}
+		if !cmp.Equal(d.Extended, want[i]) {
+			t.Errorf("file %d: got - want extended headers:\n%s", i, cmp.Diff(want[i], d.Extended))
+		}
+	}
+
+	d, err := ParseFileDiffOptions([]byte(`diff --git a/run.sh b/run.sh
+mode 100644,100644..100755
+--- a/run.sh
++++ b/run.sh
+@@ -1,1 +1,1 @@
+-x
++y
+`), ParseOptions{MaxLineBytes: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"diff --git a/run.sh b/run.sh", "mode 100644,100644..100755"}; !cmp.Equal(d.Extended, want) {
+		t.Errorf("got - want extended headers:\n%s", cmp.Diff(want, d.Extended))
+	}
+}
+
+func TestParseMultiFileDiffPreambleBeforeBinary(t *testing.T) {
+	const gitDiff = `diff --git a/x.png b/x.png
+index 1234567..89abcde 100644
+Binary files a/x.png and b/x.png differ
+`
+	for _, preamble := range []string{"", "Subject: [PATCH] Update image\n\n", "Index: x.png\n"} {
+		diffs, err := ParseMultiFileDiff([]byte(preamble + gitDiff))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(diffs) != 1 {
+			t.Fatalf("preamble %q: got %d file diffs, want 1", preamble, len(diffs))
+		}
+		d := diffs[0]
+		if d.Kind != KindUnified {
+			t.Errorf("preamble %q: got Kind %v, want %v", preamble, d.Kind, KindUnified)
+		}
+		want := []string{"diff --git a/x.png b/x.png", "index 1234567..89abcde 100644", "Binary files a/x.png and b/x.png differ"}
+		if !cmp.Equal(d.Extended, want) {
+			t.Errorf("preamble %q: got - want extended headers:\n%s", preamble, cmp.Diff(want, d.Extended))
+		}
+		if d.OrigName != "a/x.png" || d.NewName != "b/x.png" {
+			t.Errorf("preamble %q: got names %q and %q, want %q and %q", preamble, d.OrigName, d.NewName, "a/x.png", "b/x.png")
+		}
+	}
+}
+
 func TestNoNewlineAtEnd(t *testing.T) {
 	diffs := map[string]struct {
 		diff              string
@@ -1218,3 +1619,77 @@ func TestParseMultiFileDiff_KeepCR_E2E(t *testing.T) {
 		t.Errorf("Expected 3 extended headers for file 2, got %d", len(fd2.Extended))
 	}
 }
+
+func TestParseContext(t *testing.T) {
+	diffData, err := ioutil.ReadFile(filepath.Join("testdata", "sample_multi_file.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewMultiFileDiffReaderContext(ctx, bytes.NewReader(diffData), ParseOptions{})
+	if _, err := r.ReadFile(); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	_, err = r.ReadFile()
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got err %v, want context.Canceled", err)
+	}
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("got err %T, want *ParseError", err)
+	}
+	if perr.Line == 0 || perr.Offset == 0 {
+		t.Errorf("got position %d:%d, want a position past the first file", perr.Line, perr.Offset)
+	}
+
+	if _, err := ParseMultiFileDiffContext(ctx, diffData, ParseOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("ParseMultiFileDiffContext: got err %v, want context.Canceled", err)
+	}
+	if _, err := ParseHunksContext(ctx, []byte("@@ -1,1 +1,1 @@\n-a\n+b\n"), ParseOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("ParseHunksContext: got err %v, want context.Canceled", err)
+	}
+}
+
+func TestPrintContext(t *testing.T) {
+	diffData, err := ioutil.ReadFile(filepath.Join("testdata", "sample_multi_file.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := ParseMultiFileDiff(diffData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := PrintMultiFileDiffContext(context.Background(), diffs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, diffData) {
+		t.Errorf("PrintMultiFileDiffContext output differs from input:\n%s", cmp.Diff(string(diffData), string(out)))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := PrintMultiFileDiffContext(ctx, diffs); !errors.Is(err, context.Canceled) {
+		t.Errorf("PrintMultiFileDiffContext: got err %v, want context.Canceled", err)
+	}
+	if _, err := PrintHunksContext(ctx, diffs[0].Hunks); !errors.Is(err, context.Canceled) {
+		t.Errorf("PrintHunksContext: got err %v, want context.Canceled", err)
+	}
+}
+
+func BenchmarkFileDiff_Stat(b *testing.B) {
+	fds, err := ParseMultiFileDiff(benchmarkDiff(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, fd := range fds {
+			fd.Stat()
+		}
+	}
+}
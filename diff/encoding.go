@@ -0,0 +1,182 @@
+package diff
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// An Encoding is the character encoding of diff input. The parser works on
+// UTF-8 (or any ASCII-compatible encoding); other encodings are transcoded
+// to UTF-8 before parsing.
+type Encoding int
+
+const (
+	// EncodingNone reads the input as is (the default).
+	EncodingNone Encoding = iota
+
+	// EncodingAuto sniffs a byte order mark at the start of the input. A
+	// UTF-8 BOM is dropped and a UTF-16 BOM selects the matching UTF-16
+	// decoding. Input without a BOM is read as is.
+	EncodingAuto
+
+	// EncodingUTF16LE is little-endian UTF-16. A leading BOM is dropped.
+	EncodingUTF16LE
+
+	// EncodingUTF16BE is big-endian UTF-16. A leading BOM is dropped.
+	EncodingUTF16BE
+
+	// EncodingLatin1 is ISO 8859-1, in which every byte is the code point
+	// of the same value.
+	EncodingLatin1
+)
+
+func (e Encoding) String() string {
+	switch e {
+	case EncodingNone:
+		return "none"
+	case EncodingAuto:
+		return "auto"
+	case EncodingUTF16LE:
+		return "utf-16le"
+	case EncodingUTF16BE:
+		return "utf-16be"
+	case EncodingLatin1:
+		return "latin1"
+	}
+	return fmt.Sprintf("Encoding(%d)", int(e))
+}
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// newDecodingReader returns a reader that transcodes r from enc to UTF-8.
+func newDecodingReader(r io.Reader, enc Encoding) io.Reader {
+	switch enc {
+	case EncodingAuto:
+		br := bufio.NewReader(r)
+		head, _ := br.Peek(len(bomUTF8))
+		switch {
+		case bytes.HasPrefix(head, bomUTF8):
+			br.Discard(len(bomUTF8))
+			return br
+		case bytes.HasPrefix(head, bomUTF16LE):
+			return &utf16Reader{reader: br, littleEndian: true}
+		case bytes.HasPrefix(head, bomUTF16BE):
+			return &utf16Reader{reader: br}
+		}
+		return br
+	case EncodingUTF16LE:
+		return &utf16Reader{reader: bufio.NewReader(r), littleEndian: true}
+	case EncodingUTF16BE:
+		return &utf16Reader{reader: bufio.NewReader(r)}
+	case EncodingLatin1:
+		return &latin1Reader{reader: r}
+	}
+	return r
+}
+
+// utf16Reader transcodes UTF-16 to UTF-8. Unpaired surrogates and a
+// trailing odd byte are replaced with U+FFFD.
+type utf16Reader struct {
+	reader       *bufio.Reader
+	littleEndian bool
+	started      bool
+	pending      []byte // encoded output not yet returned
+}
+
+func (r *utf16Reader) readUnit() (uint16, error) {
+	var b [2]byte
+	n, err := io.ReadFull(r.reader, b[:])
+	if err == io.ErrUnexpectedEOF && n == 1 {
+		return utf8.RuneError, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if r.littleEndian {
+		return uint16(b[0]) | uint16(b[1])<<8, nil
+	}
+	return uint16(b[0])<<8 | uint16(b[1]), nil
+}
+
+func (r *utf16Reader) Read(p []byte) (int, error) {
+	for len(r.pending) < len(p) {
+		u, err := r.readUnit()
+		if err != nil {
+			if len(r.pending) > 0 {
+				break
+			}
+			return 0, err
+		}
+		if !r.started {
+			r.started = true
+			if u == 0xFEFF {
+				continue
+			}
+		}
+		c := rune(u)
+		if utf16.IsSurrogate(c) {
+			c = utf8.RuneError
+			if u < 0xDC00 {
+				if next, err := r.reader.Peek(2); err == nil {
+					var u2 uint16
+					if r.littleEndian {
+						u2 = uint16(next[0]) | uint16(next[1])<<8
+					} else {
+						u2 = uint16(next[0])<<8 | uint16(next[1])
+					}
+					if d := utf16.DecodeRune(rune(u), rune(u2)); d != utf8.RuneError {
+						c = d
+						r.reader.Discard(2)
+					}
+				}
+			}
+		}
+		r.pending = utf8.AppendRune(r.pending, c)
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[:copy(r.pending, r.pending[n:])]
+	return n, nil
+}
+
+// latin1Reader transcodes ISO 8859-1 to UTF-8.
+type latin1Reader struct {
+	reader  io.Reader
+	buf     []byte
+	pending []byte // encoded output not yet returned
+}
+
+func (r *latin1Reader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		if cap(r.buf) < len(p) {
+			r.buf = make([]byte, len(p))
+		}
+		n, err := r.reader.Read(r.buf[:len(p)])
+		for _, b := range r.buf[:n] {
+			r.pending = utf8.AppendRune(r.pending, rune(b))
+		}
+		if n == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[:copy(r.pending, r.pending[n:])]
+	return n, nil
+}
+
+// hunksValidUTF8 reports whether the bodies of all hunks are valid UTF-8.
+func hunksValidUTF8(hunks []*Hunk) bool {
+	for _, h := range hunks {
+		if !utf8.Valid(h.Body) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+package diff
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func encodeUTF16(s string, littleEndian, bom bool) []byte {
+	units := utf16.Encode([]rune(s))
+	if bom {
+		units = append([]uint16{0xFEFF}, units...)
+	}
+	var b []byte
+	for _, u := range units {
+		if littleEndian {
+			b = append(b, byte(u), byte(u>>8))
+		} else {
+			b = append(b, byte(u>>8), byte(u))
+		}
+	}
+	return b
+}
+
+func TestParseMultiFileDiff_Encoding(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sample_multi_file.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ParseMultiFileDiff(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		input    []byte
+		encoding Encoding
+	}{
+		"utf-8 bom":          {append(append([]byte{}, bomUTF8...), data...), EncodingAuto},
+		"utf-16le bom":       {encodeUTF16(string(data), true, true), EncodingAuto},
+		"utf-16be bom":       {encodeUTF16(string(data), false, true), EncodingAuto},
+		"utf-16le explicit":  {encodeUTF16(string(data), true, false), EncodingUTF16LE},
+		"utf-16be explicit":  {encodeUTF16(string(data), false, true), EncodingUTF16BE},
+		"auto without a bom": {data, EncodingAuto},
+	}
+	for label, test := range tests {
+		t.Run(label, func(t *testing.T) {
+			got, err := ParseMultiFileDiffOptions(test.input, ParseOptions{Encoding: test.encoding})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(got, want) {
+				t.Errorf("got - want:\n%s", cmp.Diff(want, got))
+			}
+		})
+	}
+}
+
+func TestDecodingReader(t *testing.T) {
+	tests := map[string]struct {
+		input    []byte
+		encoding Encoding
+		want     string
+	}{
+		"latin1": {
+			input:    []byte("caf\xe9 \xfc\n"),
+			encoding: EncodingLatin1,
+			want:     "café ü\n",
+		},
+		"utf-16 surrogate pair": {
+			input:    encodeUTF16("a\U0001F600b", true, false),
+			encoding: EncodingUTF16LE,
+			want:     "a\U0001F600b",
+		},
+		"utf-16 unpaired surrogate": {
+			input:    []byte{'a', 0, 0x00, 0xD8, 'b', 0},
+			encoding: EncodingUTF16LE,
+			want:     "a�b",
+		},
+		"utf-16 odd byte": {
+			input:    []byte{0, 'a', 0},
+			encoding: EncodingUTF16BE,
+			want:     "a�",
+		},
+	}
+	for label, test := range tests {
+		t.Run(label, func(t *testing.T) {
+			// One-byte reads exercise the pending output buffers.
+			var got bytes.Buffer
+			r := newDecodingReader(bytes.NewReader(test.input), test.encoding)
+			p := make([]byte, 1)
+			for {
+				n, err := r.Read(p)
+				got.Write(p[:n])
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got.String() != test.want {
+				t.Errorf("got %q, want %q", got.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestFileDiff_InvalidUTF8(t *testing.T) {
+	input := "--- a.txt\n+++ a.txt\n@@ -1,1 +1,1 @@\n-caf\xe9\n+cafe\n"
+
+	fd, err := ParseFileDiff([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fd.InvalidUTF8 {
+		t.Error("got InvalidUTF8 == false for Latin-1 content, want true")
+	}
+
+	fd, err = ParseFileDiffOptions([]byte(input), ParseOptions{Encoding: EncodingLatin1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fd.InvalidUTF8 {
+		t.Error("got InvalidUTF8 == true after decoding Latin-1, want false")
+	}
+	if want := "-café\n+cafe\n"; string(fd.Hunks[0].Body) != want {
+		t.Errorf("got body %q, want %q", fd.Hunks[0].Body, want)
+	}
+}
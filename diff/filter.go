@@ -0,0 +1,396 @@
+package diff
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// A PathFilter selects the files of a diff by their paths. As in a
+// .gitignore file, the last pattern that matches one of a file's paths
+// decides whether it is selected, so a later pattern can select files that
+// an earlier one excluded. A file that no pattern matches is selected only
+// if there are no include patterns. An exclude pathspec excludes the files
+// it matches whatever comes after it, as in git. A file's paths are its
+// OrigName and NewName, without the "a/" or "b/" prefix git adds.
+type PathFilter struct {
+	patterns []pathPattern
+	// include is whether there are include patterns.
+	include bool
+}
+
+// A pathPattern is a parsed pattern of a PathFilter.
+type pathPattern struct {
+	pattern string
+	// exclude is whether the pattern excludes the files it matches.
+	exclude bool
+	// pathspec is whether the pattern is a git pathspec (rather than a
+	// gitignore pattern), and glob and literal are its magic.
+	pathspec, glob, literal bool
+	icase                   bool
+	// anchored is whether a gitignore pattern only matches from the top
+	// directory, and dirOnly whether it only matches directories.
+	anchored, dirOnly bool
+}
+
+// NewPathFilter returns a PathFilter for the given patterns, which are
+// either gitignore patterns or git pathspecs.
+//
+// A gitignore pattern is matched as in a .gitignore file at the top
+// directory: "*" and "?" do not match "/", "**" matches any number of
+// directories, a pattern without a "/" (except at its end) matches at any
+// depth, a pattern ending in "/" only matches directories, and a pattern
+// that matches a directory matches all the files under it. A pattern
+// starting with "!" is an exclude pattern, which excludes the files it
+// matches unless a later pattern selects them again.
+//
+// A pattern starting with ":" is a pathspec, which matches a path it is a
+// directory of, or that it matches as a wildcard pattern where "*" matches
+// "/" too. Its magic is given as in ":(exclude,glob)pattern" or with the
+// short forms ":!pattern" and ":^pattern" for exclude. The supported magic
+// words are exclude, glob (match "*" and "**" as gitignore patterns do),
+// literal (no wildcards), icase (ignore case) and top (which has no effect,
+// since paths are always relative to the top directory).
+func NewPathFilter(patterns ...string) (*PathFilter, error) {
+	f := &PathFilter{}
+	for _, s := range patterns {
+		p, err := parsePathPattern(s)
+		if err != nil {
+			return nil, err
+		}
+		f.patterns = append(f.patterns, p)
+		f.include = f.include || !p.exclude
+	}
+	return f, nil
+}
+
+// ErrBadPathPattern is when a pattern given to NewPathFilter is malformed.
+var ErrBadPathPattern = errors.New("bad path pattern")
+
+func parsePathPattern(s string) (p pathPattern, err error) {
+	if !strings.HasPrefix(s, ":") {
+		if strings.HasPrefix(s, "!") {
+			s, p.exclude = s[1:], true
+		} else if strings.HasPrefix(s, `\!`) {
+			s = s[1:]
+		}
+		p.pattern = strings.TrimSuffix(s, "/")
+		p.dirOnly = p.pattern != s
+		p.anchored = strings.Contains(p.pattern, "/")
+		p.pattern = strings.TrimPrefix(p.pattern, "/")
+		if p.pattern == "" {
+			return p, ErrBadPathPattern
+		}
+		return p, nil
+	}
+
+	p.pathspec = true
+	s = s[1:]
+	if strings.HasPrefix(s, "(") {
+		end := strings.IndexByte(s, ')')
+		if end < 0 {
+			return p, ErrBadPathPattern
+		}
+		for _, magic := range strings.Split(s[1:end], ",") {
+			switch strings.TrimSpace(magic) {
+			case "exclude":
+				p.exclude = true
+			case "glob":
+				p.glob = true
+			case "literal":
+				p.literal = true
+			case "icase":
+				p.icase = true
+			case "top", "":
+			default:
+				return p, ErrBadPathPattern
+			}
+		}
+		s = s[end+1:]
+	} else {
+		for len(s) > 0 && strings.IndexByte("!^/", s[0]) >= 0 {
+			if s[0] != '/' {
+				p.exclude = true
+			}
+			s = s[1:]
+		}
+		if strings.HasPrefix(s, ":") {
+			s = s[1:]
+		}
+	}
+	if p.glob && p.literal {
+		return p, ErrBadPathPattern
+	}
+	p.pattern = strings.TrimSuffix(s, "/")
+	if p.icase {
+		p.pattern = strings.ToLower(p.pattern)
+	}
+	return p, nil
+}
+
+// match reports whether the pattern matches the path.
+func (p *pathPattern) match(path string) bool {
+	if p.icase {
+		path = strings.ToLower(path)
+	}
+	if p.pathspec {
+		if p.pattern == "" || path == p.pattern || strings.HasPrefix(path, p.pattern+"/") {
+			return true
+		}
+		switch {
+		case p.literal:
+			return false
+		case p.glob:
+			return matchPathGlob(p.pattern, path)
+		}
+		return matchWildcard(p.pattern, path)
+	}
+
+	// Match the path or any of its directories, starting at the top
+	// directory if the pattern is anchored and at any directory if not.
+	parts := strings.Split(path, "/")
+	for start := 0; start < len(parts); start++ {
+		if p.anchored && start > 0 {
+			break
+		}
+		for end := start + 1; end <= len(parts); end++ {
+			if end == len(parts) && p.dirOnly {
+				break
+			}
+			if matchPathGlob(p.pattern, strings.Join(parts[start:end], "/")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Match reports whether f selects the file diff fd.
+func (f *PathFilter) Match(fd *FileDiff) bool {
+	var paths []string
+	for _, name := range []string{fd.OrigName, fd.NewName} {
+		if p := diffPath(name); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	selected := !f.include
+	for i := range f.patterns {
+		p := &f.patterns[i]
+		for _, path := range paths {
+			if p.match(path) {
+				if p.exclude && p.pathspec {
+					return false
+				}
+				selected = !p.exclude
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// Filter returns the file diffs of fds that f selects. The Preamble of a
+// file that is not selected (such as the commit message before the first
+// file of a patch made by "git format-patch") is not dropped with it: it
+// is put before the Preamble of the next selected file, which is copied
+// for that, or else returned as rest.
+func (f *PathFilter) Filter(fds []*FileDiff) (selected []*FileDiff, rest []string) {
+	for _, fd := range fds {
+		if !f.Match(fd) {
+			rest = append(rest, fd.Preamble...)
+			continue
+		}
+		if len(rest) > 0 {
+			c := *fd
+			c.Preamble = append(rest, fd.Preamble...)
+			fd, rest = &c, nil
+		}
+		selected = append(selected, fd)
+	}
+	return selected, rest
+}
+
+// A FilterReader reads the files of a multi-file diff that a PathFilter
+// selects. As with PathFilter.Filter, the Preamble of a file that is not
+// selected is put before that of the next selected file, or else before
+// the Epilogue.
+type FilterReader struct {
+	r      *MultiFileDiffReader
+	filter *PathFilter
+
+	// preamble is the Preamble of the files skipped since the last
+	// selected file.
+	preamble []string
+}
+
+// NewFilterReader returns a new FilterReader that reads the files of r that
+// filter selects.
+func NewFilterReader(r *MultiFileDiffReader, filter *PathFilter) *FilterReader {
+	return &FilterReader{r: r, filter: filter}
+}
+
+// ReadFile reads the next selected file. It returns io.EOF when there are
+// no more files.
+func (r *FilterReader) ReadFile() (*FileDiff, error) {
+	for {
+		fd, err := r.r.ReadFile()
+		if err != nil {
+			return fd, err
+		}
+		if !r.filter.Match(fd) {
+			r.preamble = append(r.preamble, fd.Preamble...)
+			continue
+		}
+		if len(r.preamble) > 0 {
+			fd.Preamble = append(r.preamble, fd.Preamble...)
+			r.preamble = nil
+		}
+		return fd, nil
+	}
+}
+
+// Epilogue returns the lines of non-diff content that followed the last
+// file in the diff, whether or not that file was selected (see
+// MultiFileDiffReader.Epilogue), after the Preamble of the files after the
+// last selected file.
+func (r *FilterReader) Epilogue() []string {
+	if len(r.preamble) == 0 {
+		return r.r.Epilogue()
+	}
+	return append(append([]string(nil), r.preamble...), r.r.Epilogue()...)
+}
+
+// ReadAllFiles reads all remaining selected files. A successful call
+// returns err == nil, not err == EOF.
+func (r *FilterReader) ReadAllFiles() ([]*FileDiff, error) {
+	var fds []*FileDiff
+	for {
+		fd, err := r.ReadFile()
+		if fd != nil {
+			fds = append(fds, fd)
+		}
+		if err == io.EOF {
+			return fds, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// matchPathGlob reports whether the path matches the wildcard pattern,
+// where "*" and "?" do not match "/" and a "**" component matches any
+// number of directories.
+func matchPathGlob(pattern, path string) bool {
+	return matchComponents(strings.Split(pattern, "/"), strings.Split(path, "/"))
+}
+
+func matchComponents(patterns, names []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			patterns = patterns[1:]
+			if len(patterns) == 0 {
+				// A trailing "**" matches everything inside, but not the
+				// directory itself.
+				return len(names) > 0
+			}
+			for i := 0; i <= len(names); i++ {
+				if matchComponents(patterns, names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 || !matchWildcard(patterns[0], names[0]) {
+			return false
+		}
+		patterns, names = patterns[1:], names[1:]
+	}
+	return len(names) == 0
+}
+
+// matchWildcard reports whether name matches the wildcard pattern, with "*"
+// (any string), "?" (any character), "[...]" (character classes, negated
+// with "!" or "^") and "\" (escaping the next character).
+func matchWildcard(pattern, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchWildcard(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if name == "" {
+				return false
+			}
+			_, n := utf8.DecodeRuneInString(name)
+			pattern, name = pattern[1:], name[n:]
+			continue
+		case '[':
+			if name == "" {
+				return false
+			}
+			r, n := utf8.DecodeRuneInString(name)
+			if matched, rest, ok := matchClass(pattern[1:], r); ok {
+				if !matched {
+					return false
+				}
+				pattern, name = rest, name[n:]
+				continue
+			}
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+		}
+		if name == "" || name[0] != pattern[0] {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return name == ""
+}
+
+// matchClass matches r against the character class at the start of
+// pattern (just after its "["), returning the rest of the pattern. ok is
+// false if the class is not terminated.
+func matchClass(pattern string, r rune) (matched bool, rest string, ok bool) {
+	negate := false
+	if len(pattern) > 0 && (pattern[0] == '!' || pattern[0] == '^') {
+		negate, pattern = true, pattern[1:]
+	}
+	for i := 0; len(pattern) > 0; i++ {
+		if pattern[0] == ']' && i > 0 {
+			return matched != negate, pattern[1:], true
+		}
+		lo, n := classChar(pattern)
+		pattern = pattern[n:]
+		hi := lo
+		if len(pattern) > 1 && pattern[0] == '-' && pattern[1] != ']' {
+			hi, n = classChar(pattern[1:])
+			pattern = pattern[1+n:]
+		}
+		if lo <= r && r <= hi {
+			matched = true
+		}
+	}
+	return false, "", false
+}
+
+// classChar returns the (possibly escaped) character at the start of s and
+// its length.
+func classChar(s string) (rune, int) {
+	if s[0] == '\\' && len(s) > 1 {
+		r, n := utf8.DecodeRuneInString(s[1:])
+		return r, n + 1
+	}
+	return utf8.DecodeRuneInString(s)
+}
@@ -0,0 +1,212 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPathFilter_Match(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{nil, "a.go", true},
+
+		// gitignore patterns
+		{[]string{"*.go"}, "a.go", true},
+		{[]string{"*.go"}, "dir/sub/a.go", true},
+		{[]string{"*.go"}, "a.go.txt", false},
+		{[]string{"vendor/"}, "vendor/x/a.go", true},
+		{[]string{"vendor/"}, "vendor", false},
+		{[]string{"vendor"}, "src/vendor/a.go", true},
+		{[]string{"/vendor"}, "src/vendor/a.go", false},
+		{[]string{"src/*.go"}, "src/a.go", true},
+		{[]string{"src/*.go"}, "src/x/a.go", false},
+		{[]string{"src/*.go"}, "lib/src/a.go", false},
+		{[]string{"src/**/*.go"}, "src/x/y/a.go", true},
+		{[]string{"**/gen"}, "a/b/gen/x.go", true},
+		{[]string{"a?.[ch]"}, "ab.c", true},
+		{[]string{"a?.[!ch]"}, "ab.c", false},
+		{[]string{"*.go", "!*_test.go"}, "a_test.go", false},
+		{[]string{"!*_test.go"}, "a.go", true},
+		{[]string{"*.go", "!vendor/**/*.go", "vendor/keep/*.go"}, "vendor/keep/x.go", true},
+		{[]string{"*.go", "!vendor/**/*.go", "vendor/keep/*.go"}, "vendor/drop/x.go", false},
+		{[]string{"!*_test.go", "*.go"}, "a_test.go", true},
+
+		// pathspecs
+		{[]string{":src"}, "src/x/a.go", true},
+		{[]string{":*.go"}, "src/x/a.go", true},
+		{[]string{":(glob)*.go"}, "src/x/a.go", false},
+		{[]string{":(glob)**/*.go"}, "src/x/a.go", true},
+		{[]string{":(literal)*.go"}, "*.go", true},
+		{[]string{":(literal)*.go"}, "a.go", false},
+		{[]string{":(icase)SRC"}, "src/a.go", true},
+		{[]string{":(exclude)vendor"}, "vendor/a.go", false},
+		{[]string{":(exclude)vendor"}, "src/a.go", true},
+		{[]string{":!vendor"}, "vendor/a.go", false},
+		{[]string{"src", ":^src/gen"}, "src/gen/a.go", false},
+		{[]string{":^src/gen", "src"}, "src/gen/a.go", false},
+	}
+	for _, test := range tests {
+		f, err := NewPathFilter(test.patterns...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fd := &FileDiff{OrigName: "a/" + test.path, NewName: "b/" + test.path}
+		if got := f.Match(fd); got != test.want {
+			t.Errorf("%q matching %q: got %v, want %v", test.patterns, test.path, got, test.want)
+		}
+	}
+}
+
+func TestPathFilter_Match_rename(t *testing.T) {
+	f, err := NewPathFilter("!vendor/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Match(&FileDiff{OrigName: "a/vendor/x.go", NewName: "b/x.go"}) {
+		t.Error("got match for a file renamed out of an excluded directory")
+	}
+	f, err = NewPathFilter("src/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Match(&FileDiff{OrigName: "/dev/null", NewName: "b/src/x.go"}) {
+		t.Error("got no match for an added file")
+	}
+}
+
+func TestNewPathFilter_bad(t *testing.T) {
+	for _, pattern := range []string{":(unknown)x", ":(glob,literal)x", ":(glob", "!"} {
+		if _, err := NewPathFilter(pattern); err == nil {
+			t.Errorf("%q: got no error", pattern)
+		}
+	}
+}
+
+func TestFilterReader(t *testing.T) {
+	const input = `--- a/keep.go
++++ b/keep.go
+@@ -1 +1 @@
+-a
++b
+--- a/vendor/drop.go
++++ b/vendor/drop.go
+@@ -1 +1 @@
+-c
++d
+--- a/keep_too.go
++++ b/keep_too.go
+@@ -1 +1 @@
+-e
++f
+--- a/vendor/drop_too.go
++++ b/vendor/drop_too.go
+@@ -1 +1 @@
+-g
++h
+exit status 0
+`
+	f, err := NewPathFilter("*.go", ":(exclude)vendor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewFilterReader(NewMultiFileDiffReader(strings.NewReader(input)), f)
+	fds, err := r.ReadAllFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fds) != 2 || fds[0].NewName != "b/keep.go" || fds[1].NewName != "b/keep_too.go" {
+		t.Errorf("got %d files", len(fds))
+	}
+	if got, want := r.Epilogue(), []string{"exit status 0"}; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got epilogue %q, want %q", got, want)
+	}
+
+	all, err := ParseMultiFileDiff([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, rest := f.Filter(all); len(got) != 2 || got[0] != all[0] || got[1] != all[2] || len(rest) != 0 {
+		t.Errorf("Filter: got %d files and %q", len(got), rest)
+	}
+}
+
+func TestFilterReader_Preamble(t *testing.T) {
+	// Two patches from "git format-patch": the commit message of each is
+	// the Preamble of its first file, which is filtered out.
+	const input = `From 0123456789abcdef0123456789abcdef01234567 Mon Sep 17 00:00:00 2001
+Subject: [PATCH 1/2] Update x
+
+---
+diff --git a/vendor/v.go b/vendor/v.go
+--- a/vendor/v.go
++++ b/vendor/v.go
+@@ -1 +1 @@
+-a
++b
+diff --git a/x.go b/x.go
+--- a/x.go
++++ b/x.go
+@@ -1 +1 @@
+-c
++d
+From 89abcdef0123456789abcdef0123456789abcdef Mon Sep 17 00:00:00 2001
+Subject: [PATCH 2/2] Update vendor
+
+---
+diff --git a/vendor/w.go b/vendor/w.go
+--- a/vendor/w.go
++++ b/vendor/w.go
+@@ -1 +1 @@
+-e
++f
+`
+	f, err := NewPathFilter("!vendor/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPreamble := []string{
+		"From 0123456789abcdef0123456789abcdef01234567 Mon Sep 17 00:00:00 2001",
+		"Subject: [PATCH 1/2] Update x",
+		"",
+		"---",
+	}
+	wantRest := []string{
+		"From 89abcdef0123456789abcdef0123456789abcdef Mon Sep 17 00:00:00 2001",
+		"Subject: [PATCH 2/2] Update vendor",
+		"",
+		"---",
+	}
+
+	r := NewFilterReader(NewMultiFileDiffReader(strings.NewReader(input)), f)
+	fds, err := r.ReadAllFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fds) != 1 || fds[0].NewName != "b/x.go" {
+		t.Fatalf("got %d files", len(fds))
+	}
+	if !equalLines(fds[0].Preamble, wantPreamble) {
+		t.Errorf("got preamble %q, want %q", fds[0].Preamble, wantPreamble)
+	}
+	if !equalLines(r.Epilogue(), wantRest) {
+		t.Errorf("got epilogue %q, want %q", r.Epilogue(), wantRest)
+	}
+
+	all, err := ParseMultiFileDiff([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, rest := f.Filter(all)
+	if len(got) != 1 {
+		t.Fatalf("Filter: got %d files", len(got))
+	}
+	if !equalLines(got[0].Preamble, wantPreamble) || !equalLines(rest, wantRest) {
+		t.Errorf("Filter: got preamble %q and rest %q", got[0].Preamble, rest)
+	}
+	if len(all[1].Preamble) != 0 {
+		t.Errorf("Filter changed the Preamble of its input to %q", all[1].Preamble)
+	}
+}
@@ -0,0 +1,235 @@
+package diff
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+)
+
+// An Index records where each file and hunk of a multi-file diff is, so
+// that they can be read from an io.ReaderAt without parsing the whole
+// diff (see IndexReader). An Index has only exported fields of basic types,
+// so it can be serialized with, e.g., encoding/json or encoding/gob.
+type Index struct {
+	// Size is the size of the indexed diff.
+	Size int64
+	// Files are the files of the diff, in order.
+	Files []IndexFile
+}
+
+// An IndexFile is the entry of an Index for one FileDiff.
+type IndexFile struct {
+	// the file names, as in FileDiff
+	OrigName, NewName string
+	// byte range of the piece of the diff the file is parsed from; it may
+	// hold other files without hunks (e.g., git diffs of empty files)
+	// before this one
+	Start, End int64
+	// index of the file among those parsed from Start to End
+	Sub int
+	// the file's hunks (nil if they could not be located)
+	Hunks []IndexHunk
+}
+
+// An IndexHunk is the byte range of a hunk, from its hunk header to the
+// end of its body (which may be followed by non-diff content).
+type IndexHunk struct {
+	Start, End int64
+	// the Hunk's StartPosition
+	StartPosition int32
+}
+
+// BuildIndex reads the multi-file diff of the given size from r with the
+// given options and returns its index. It only holds one file's diff in
+// memory at a time.
+func BuildIndex(r io.ReaderAt, size int64, opts ParseOptions) (*Index, error) {
+	idx := &Index{Size: size}
+	br := bufio.NewReader(io.NewSectionReader(r, 0, size))
+	s := boundaryScanner{keepCR: opts.KeepCR}
+
+	var segStart int64
+	var segLine int
+	var hunkStarts []int64
+	addSegment := func(end int64) error {
+		files, err := indexSegment(r, segStart, end, hunkStarts, opts)
+		if err != nil {
+			if e, ok := err.(*ParseError); ok {
+				e.Line += segLine
+				e.Offset += segStart - int64(segLine)
+			}
+			return err
+		}
+		idx.Files = append(idx.Files, files...)
+		return nil
+	}
+
+	for {
+		raw, err := readRawLineBytes(br)
+		if len(raw) > 0 {
+			if pos, line, ok := s.scan(raw); ok {
+				if err := addSegment(pos); err != nil {
+					return nil, err
+				}
+				segStart, segLine, hunkStarts = pos, line, nil
+			}
+			if s.hunkStart {
+				hunkStarts = append(hunkStarts, s.pos-int64(len(raw)))
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := addSegment(size); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// readRawLineBytes reads the next line from r, including its newline.
+func readRawLineBytes(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != bufio.ErrBufferFull {
+		return line, err
+	}
+	line = append([]byte(nil), line...)
+	for err == bufio.ErrBufferFull {
+		var frag []byte
+		frag, err = r.ReadSlice('\n')
+		line = append(line, frag...)
+	}
+	return line, err
+}
+
+// indexSegment parses the part of the diff from start to end and returns
+// the index entries of its files. hunkStarts are the offsets of the hunk
+// headers in the segment.
+func indexSegment(r io.ReaderAt, start, end int64, hunkStarts []int64, opts ParseOptions) ([]IndexFile, error) {
+	fds, err := readIndexRange(r, start, end, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var hunks int
+	for _, fd := range fds {
+		hunks += len(fd.Hunks)
+	}
+	locateHunks := hunks == len(hunkStarts)
+
+	files := make([]IndexFile, len(fds))
+	for i, fd := range fds {
+		files[i] = IndexFile{OrigName: fd.OrigName, NewName: fd.NewName, Start: start, End: end, Sub: i}
+		if !locateHunks {
+			continue
+		}
+		for _, h := range fd.Hunks {
+			hunkEnd := end
+			if len(hunkStarts) > 1 {
+				hunkEnd = hunkStarts[1]
+			}
+			files[i].Hunks = append(files[i].Hunks, IndexHunk{Start: hunkStarts[0], End: hunkEnd, StartPosition: h.StartPosition})
+			hunkStarts = hunkStarts[1:]
+		}
+	}
+	return files, nil
+}
+
+func readIndexRange(r io.ReaderAt, start, end int64, opts ParseOptions) ([]*FileDiff, error) {
+	return NewMultiFileDiffReaderOptions(io.NewSectionReader(r, start, end-start), opts).ReadAllFiles()
+}
+
+// ErrNotInIndex is when a file or hunk that is not in the index is
+// requested from an IndexReader.
+var ErrNotInIndex = errors.New("not in index")
+
+// An IndexReader reads single files and hunks of an indexed diff.
+type IndexReader struct {
+	r     io.ReaderAt
+	index *Index
+	opts  ParseOptions
+}
+
+// NewIndexReader returns a new IndexReader that reads the diff in r, which
+// index was built from with the same options.
+func NewIndexReader(r io.ReaderAt, index *Index, opts ParseOptions) *IndexReader {
+	return &IndexReader{r: r, index: index, opts: opts}
+}
+
+// ReadFile reads the i'th file of the diff.
+func (x *IndexReader) ReadFile(i int) (*FileDiff, error) {
+	if i < 0 || i >= len(x.index.Files) {
+		return nil, ErrNotInIndex
+	}
+	f := x.index.Files[i]
+	fds, err := readIndexRange(x.r, f.Start, f.End, x.opts)
+	if err != nil {
+		return nil, err
+	}
+	if f.Sub >= len(fds) {
+		return nil, ErrNotInIndex
+	}
+	return fds[f.Sub], nil
+}
+
+// ReadFileByPath reads the first file of the diff whose new or original
+// path is name, where the paths are the names without the "b/" (new) or
+// "a/" (original) prefix git adds. If there is none, it reads the first
+// file whose new or original name is name.
+func (x *IndexReader) ReadFileByPath(name string) (*FileDiff, error) {
+	for _, trim := range []bool{true, false} {
+		for i, f := range x.index.Files {
+			newName, origName := f.NewName, f.OrigName
+			if trim {
+				newName, origName = strings.TrimPrefix(newName, "b/"), strings.TrimPrefix(origName, "a/")
+			}
+			if newName == name || origName == name {
+				return x.ReadFile(i)
+			}
+		}
+	}
+	return nil, ErrNotInIndex
+}
+
+// ReadHunk reads the j'th hunk of the i'th file of the diff.
+func (x *IndexReader) ReadHunk(i, j int) (*Hunk, error) {
+	if i < 0 || i >= len(x.index.Files) {
+		return nil, ErrNotInIndex
+	}
+	f := x.index.Files[i]
+	if f.Hunks == nil {
+		// The hunks could not be located, so read the whole file.
+		fd, err := x.ReadFile(i)
+		if err != nil {
+			return nil, err
+		}
+		if j < 0 || j >= len(fd.Hunks) {
+			return nil, ErrNotInIndex
+		}
+		return fd.Hunks[j], nil
+	}
+	if j < 0 || j >= len(f.Hunks) {
+		return nil, ErrNotInIndex
+	}
+
+	h := f.Hunks[j]
+	data := make([]byte, h.End-h.Start)
+	if _, err := x.r.ReadAt(data, h.Start); err != nil && err != io.EOF {
+		return nil, err
+	}
+	hunk, err := NewHunksReaderOptions(bytes.NewReader(data), x.opts).ReadHunk()
+	if err != nil {
+		if e, ok := err.(*ParseError); !ok || hunk == nil {
+			return nil, err
+		} else if _, ok := e.Err.(*ErrBadHunkLine); !ok {
+			return nil, err
+		}
+		// The hunk is followed by non-diff content or another file.
+	}
+	hunk.StartPosition = h.StartPosition
+	return hunk, nil
+}
@@ -0,0 +1,139 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuildIndex(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "*.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fixture := range fixtures {
+		t.Run(filepath.Base(fixture), func(t *testing.T) {
+			data, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := ParseMultiFileDiff(data)
+			if err != nil {
+				t.Skip("not a multi-file diff")
+			}
+
+			idx, err := BuildIndex(bytes.NewReader(data), int64(len(data)), ParseOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(idx.Files) != len(want) {
+				t.Fatalf("got %d files in index, want %d", len(idx.Files), len(want))
+			}
+
+			x := NewIndexReader(bytes.NewReader(data), idx, ParseOptions{})
+			for i, wantFile := range want {
+				got, err := x.ReadFile(i)
+				if err != nil {
+					t.Fatalf("file %d: %s", i, err)
+				}
+				if !reflect.DeepEqual(got, wantFile) {
+					t.Errorf("file %d: got - want:\n%s", i, cmp.Diff(wantFile, got))
+				}
+				if idx.Files[i].Hunks == nil && wantFile.Hunks != nil {
+					t.Errorf("file %d: hunks were not located", i)
+				}
+				for j, wantHunk := range wantFile.Hunks {
+					got, err := x.ReadHunk(i, j)
+					if err != nil {
+						t.Fatalf("file %d, hunk %d: %s", i, j, err)
+					}
+					if !reflect.DeepEqual(got, wantHunk) {
+						t.Errorf("file %d, hunk %d: got - want:\n%s", i, j, cmp.Diff(wantHunk, got))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestIndexReader(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sample_multi_file_rename.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := BuildIndex(bytes.NewReader(data), int64(len(data)), ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The index survives serialization.
+	b, err := json.Marshal(idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Index
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(&decoded, idx) {
+		t.Fatalf("decoded index differs:\n%s", cmp.Diff(idx, &decoded))
+	}
+
+	x := NewIndexReader(bytes.NewReader(data), &decoded, ParseOptions{})
+	for _, name := range []string{"b/README.md", "README.md"} {
+		fd, err := x.ReadFileByPath(name)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if fd.NewName != "b/README.md" {
+			t.Errorf("%s: got file %q", name, fd.NewName)
+		}
+	}
+	if _, err := x.ReadFileByPath("nonexistent"); !errors.Is(err, ErrNotInIndex) {
+		t.Errorf("got err %v, want ErrNotInIndex", err)
+	}
+	if _, err := x.ReadFile(len(idx.Files)); !errors.Is(err, ErrNotInIndex) {
+		t.Errorf("got err %v, want ErrNotInIndex", err)
+	}
+	if _, err := x.ReadHunk(0, 100); !errors.Is(err, ErrNotInIndex) {
+		t.Errorf("got err %v, want ErrNotInIndex", err)
+	}
+}
+
+func TestIndexReader_ReadFileByPath(t *testing.T) {
+	// The first file's path starts with "b/", so without its "a/" and
+	// "b/" prefixes it is "b/foo.go", not "foo.go".
+	data := []byte(`diff --git a/b/foo.go b/b/foo.go
+--- a/b/foo.go
++++ b/b/foo.go
+@@ -1 +1 @@
+-a
++b
+diff --git a/foo.go b/foo.go
+--- a/foo.go
++++ b/foo.go
+@@ -1 +1 @@
+-c
++d
+`)
+	idx, err := BuildIndex(bytes.NewReader(data), int64(len(data)), ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := NewIndexReader(bytes.NewReader(data), idx, ParseOptions{})
+	for name, want := range map[string]string{"foo.go": "b/foo.go", "b/foo.go": "b/b/foo.go"} {
+		fd, err := x.ReadFileByPath(name)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if fd.NewName != want {
+			t.Errorf("%s: got file %q, want %q", name, fd.NewName, want)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Interdiff returns the changes between two versions of a multi-file patch
+// against (possibly different revisions of) the same base: for each file,
+// a diff from the file as v1 leaves it to the file as v2 leaves it, like
+// the interdiff tool. Files are matched by path (see InterdiffFile for how
+// each pair is handled). Files that both versions change in the same way
+// are left out, a file that only v1 changes is returned reversed, and a
+// file that only v2 changes is returned as it is.
+func Interdiff(v1, v2 []*FileDiff) ([]*FileDiff, error) {
+	byPath := make(map[string]*FileDiff, len(v2))
+	for _, fd := range v2 {
+		if p := fileDiffPath(fd); p != "" {
+			if _, ok := byPath[p]; !ok {
+				byPath[p] = fd
+			}
+		}
+	}
+
+	var diffs []*FileDiff
+	used := make(map[*FileDiff]bool)
+	for _, fd := range v1 {
+		p := fileDiffPath(fd)
+		other := byPath[p]
+		if other == nil || used[other] {
+			r, err := ReverseFileDiff(fd)
+			if err != nil {
+				return nil, err
+			}
+			diffs = append(diffs, r)
+			continue
+		}
+		used[other] = true
+		d, err := InterdiffFile(fd, other)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		if len(d.Hunks) > 0 {
+			diffs = append(diffs, d)
+		}
+	}
+	for _, fd := range v2 {
+		if !used[fd] {
+			diffs = append(diffs, fd)
+		}
+	}
+	return diffs, nil
+}
+
+// InterdiffFile returns the diff from the file as v1 leaves it to the file
+// as v2 leaves it, where v1 and v2 are two versions of a patch of the same
+// file.
+//
+// If the base changed between the versions, v1's hunks are first moved to
+// where their original lines are in v2's base (see rebaseHunks), so that
+// hunks that only moved because of upstream changes are not reported.
+// That is only done when hunks that both versions have show the move;
+// otherwise v1's hunks are taken to be at the same lines of the same base. Lines of the base
+// that both versions contain but that differ (because they changed
+// upstream) are taken as v2 has them.
+func InterdiffFile(v1, v2 *FileDiff) (*FileDiff, error) {
+	moved, err := rebaseHunks(v1.Hunks, v2.Hunks)
+	if err != nil {
+		return nil, err
+	}
+	reversed := make([]*Hunk, len(moved))
+	for i, h := range moved {
+		if reversed[i], err = reverseHunk(h); err != nil {
+			return nil, err
+		}
+	}
+	hunks, err := composeHunks(reversed, v2.Hunks, true)
+	if err != nil {
+		return nil, err
+	}
+	return &FileDiff{
+		OrigName:       v1.NewName,
+		OrigTime:       v1.NewTime,
+		OrigTimeLayout: v1.NewTimeLayout,
+		OrigLabel:      v1.NewLabel,
+		NewName:        v2.NewName,
+		NewTime:        v2.NewTime,
+		NewTimeLayout:  v2.NewTimeLayout,
+		NewLabel:       v2.NewLabel,
+		Hunks:          hunks,
+		InvalidUTF8:    v1.InvalidUTF8 || v2.InvalidUTF8,
+	}, nil
+}
+
+// fileDiffPath returns the path of the file a FileDiff changes (see
+// diffPath), which is its new name unless the file is deleted.
+func fileDiffPath(fd *FileDiff) string {
+	if p := diffPath(fd.NewName); p != "" {
+		return p
+	}
+	return diffPath(fd.OrigName)
+}
+
+// rebaseHunks moves each of hunks, a diff of one revision of a file, to
+// where its original lines are in the revision that base, another diff of
+// the file, is against, in case lines were added or removed upstream
+// between the revisions.
+//
+// Only hunks of base that are the same as one of hunks, but somewhere else,
+// show that the file moved: each moves the matching hunk as much, if
+// another hunk shows the same move (see below). Each hunk in between is
+// moved as much as the matching hunk before it or the one after it
+// (whichever lines up more of its original lines with those of base's
+// hunks, or else the one before it), where hunks before the first match
+// are taken to follow one that is not moved. If no hunks match, no hunks
+// are moved, since hunks whose lines merely look like lines of base
+// elsewhere in the file (as repeated code does) are no sign that the file
+// moved.
+func rebaseHunks(hunks, base []*Hunk) ([]*Hunk, error) {
+	positions := make(map[string][]int32)
+	baseLines := make([][]hunkLine, len(base))
+	for i, h := range base {
+		lines, err := hunkLines(h)
+		if err != nil {
+			return nil, err
+		}
+		baseLines[i] = lines
+		pos := hunkBegin(h.OrigStartLine, h.OrigLines)
+		for _, l := range lines {
+			if l.op != '+' {
+				positions[string(l.text)] = append(positions[string(l.text)], pos)
+				pos++
+			}
+		}
+	}
+
+	// Find the hunks that base has too, in order. Of several matches, the
+	// one that moves the hunk as much as the previous match is taken.
+	anchors := make([]int32, len(hunks))
+	anchored := make([]bool, len(hunks))
+	lines := make([][]hunkLine, len(hunks))
+	var prev int32
+	for i, j := 0, 0; i < len(hunks); i++ {
+		h := hunks[i]
+		var err error
+		if lines[i], err = hunkLines(h); err != nil {
+			return nil, err
+		}
+		begin := hunkBegin(h.OrigStartLine, h.OrigLines)
+		match := -1
+		for k := j; k < len(base); k++ {
+			if !sameHunkLines(lines[i], baseLines[k]) {
+				continue
+			}
+			d := hunkBegin(base[k].OrigStartLine, base[k].OrigLines) - begin
+			if match < 0 || abs32(d-prev) < abs32(anchors[i]-prev) {
+				match, anchors[i] = k, d
+			}
+		}
+		if match >= 0 {
+			anchored[i], prev, j = true, anchors[i], match+1
+		}
+	}
+
+	// Since hunks of repeated code can match by chance, a match that moves
+	// its hunk by more or less than the last one is only taken if another
+	// hunk up to the next match that moves by yet another amount shows the
+	// same move (by matching too, or by lining up more of its lines with
+	// those of base's hunks) and none shows the last one's.
+	prev = 0
+	for i, last := 0, -1; i < len(hunks); i++ {
+		if !anchored[i] || anchors[i] == prev {
+			if anchored[i] {
+				last = i
+			}
+			continue
+		}
+		var support, against int
+		for j := last + 1; j < len(hunks); j++ {
+			if j == i {
+				continue
+			}
+			if anchored[j] {
+				if anchors[j] != anchors[i] {
+					break
+				}
+				support++
+				continue
+			}
+			begin := hunkBegin(hunks[j].OrigStartLine, hunks[j].OrigLines)
+			switch n, m := votes(lines[j], begin, anchors[i], positions), votes(lines[j], begin, prev, positions); {
+			case n > m:
+				support++
+			case n < m:
+				against++
+			}
+		}
+		if support > 0 && against == 0 {
+			prev, last = anchors[i], i
+		} else {
+			anchored[i] = false
+		}
+	}
+
+	moved := make([]*Hunk, len(hunks))
+	var shift, before, prevEnd int32
+	for i, h := range hunks {
+		begin := hunkBegin(h.OrigStartLine, h.OrigLines)
+		s := before
+		if anchored[i] {
+			s = anchors[i]
+			before = s
+		} else if after, ok := nextAnchor(anchors, anchored, i); ok && after != before {
+			if votes(lines[i], begin, after, positions) > votes(lines[i], begin, before, positions) {
+				s = after
+			}
+		}
+		if begin+s >= prevEnd {
+			shift = s
+		}
+		prevEnd = begin + shift + h.OrigLines
+
+		m := *h
+		m.OrigStartLine = hunkStart(begin+shift, h.OrigLines)
+		m.NewStartLine = hunkStart(hunkBegin(h.NewStartLine, h.NewLines)+shift, h.NewLines)
+		moved[i] = &m
+	}
+	return moved, nil
+}
+
+// nextAnchor returns how much the first hunk after the i-th that matches a
+// hunk of base moves (see rebaseHunks).
+func nextAnchor(anchors []int32, anchored []bool, i int) (int32, bool) {
+	for i++; i < len(anchors); i++ {
+		if anchored[i] {
+			return anchors[i], true
+		}
+	}
+	return 0, false
+}
+
+// votes returns how many of the original lines of a hunk that begins at
+// begin are at the positions given for their text when moved by shift.
+func votes(lines []hunkLine, begin, shift int32, positions map[string][]int32) int {
+	var n int
+	pos := begin + shift
+	for _, l := range lines {
+		if l.op == '+' {
+			continue
+		}
+		for _, p := range positions[string(l.text)] {
+			if p == pos {
+				n++
+				break
+			}
+		}
+		pos++
+	}
+	return n
+}
+
+// sameHunkLines reports whether two hunks have the same lines.
+func sameHunkLines(a, b []hunkLine) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].op != b[i].op || !bytes.Equal(a[i].text, b[i].text) {
+			return false
+		}
+	}
+	return true
+}
+
+func abs32(n int32) int32 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,205 @@
+package diff
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestInterdiffFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		v1, v2 string
+		want   string
+	}{
+		{
+			name: "changed",
+			v1:   "@@ -4,3 +4,3 @@\n d\n-e\n+E1\n f\n",
+			v2:   "@@ -4,3 +4,3 @@\n d\n-e\n+E2\n f\n",
+			want: "@@ -4,3 +4,3 @@\n d\n-E1\n+E2\n f\n",
+		},
+		{
+			name: "same",
+			v1:   "@@ -4,3 +4,3 @@\n d\n-e\n+E\n f\n",
+			v2:   "@@ -4,3 +4,3 @@\n d\n-e\n+E\n f\n",
+			want: "",
+		},
+		{
+			name: "upstream drift",
+			v1:   "@@ -4,3 +4,3 @@\n d\n-e\n+E1\n f\n@@ -10,2 +10,3 @@\n j\n+x\n k\n",
+			v2:   "@@ -7,3 +7,3 @@\n d\n-e\n+E2\n f\n@@ -13,2 +13,3 @@\n j\n+x\n k\n",
+			want: "@@ -7,3 +7,3 @@\n d\n-E1\n+E2\n f\n",
+		},
+		{
+			name: "same change elsewhere",
+			v1:   "@@ -2,3 +2,3 @@\n x\n-nil\n+err\n }\n",
+			v2:   "@@ -6,3 +6,3 @@\n x\n-nil\n+err\n }\n",
+			want: "@@ -2,3 +2,3 @@\n x\n-err\n+nil\n }\n@@ -6,3 +6,3 @@\n x\n-nil\n+err\n }\n",
+		},
+		{
+			name: "dropped and added hunks",
+			v1:   "@@ -1,2 +1,3 @@\n a\n+x\n b\n",
+			v2:   "@@ -8,2 +8,3 @@\n h\n+y\n i\n",
+			want: "@@ -1,3 +1,2 @@\n a\n-x\n b\n@@ -9,2 +8,3 @@\n h\n+y\n i\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v1, err := ParseHunks([]byte(test.v1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			v2, err := ParseHunks([]byte(test.v2))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fd, err := InterdiffFile(&FileDiff{Hunks: v1}, &FileDiff{Hunks: v2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := PrintHunks(fd.Hunks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestInterdiff(t *testing.T) {
+	v1, err := ParseMultiFileDiff([]byte(`--- a/same
++++ b/same
+@@ -1,1 +1,1 @@
+-a
++b
+--- a/dropped
++++ b/dropped
+@@ -1,1 +1,1 @@
+-c
++d
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := ParseMultiFileDiff([]byte(`--- a/same
++++ b/same
+@@ -1,1 +1,1 @@
+-a
++b
+--- a/added
++++ b/added
+@@ -1,1 +1,1 @@
+-e
++f
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fds, err := Interdiff(v1, v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fds) != 2 {
+		t.Fatalf("got %d files, want 2", len(fds))
+	}
+	got, err := PrintMultiFileDiff(fds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `--- b/dropped
++++ a/dropped
+@@ -1,1 +1,1 @@
+-d
++c
+--- a/added
++++ b/added
+@@ -1,1 +1,1 @@
+-e
++f
+`
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+// randomEdit returns a diff of orig with random changes, and the new file.
+// Its changes are drawn from a few lines, so that the same change is often
+// made at several places.
+func randomEdit(rnd *rand.Rand, orig []string) (*FileDiff, string, error) {
+	replacements := []string{"return err", `return errors.New("x")`, "y := 2"}
+	var lines []hunkLine
+	var new strings.Builder
+	add := func(text string) {
+		lines = append(lines, hunkLine{'+', []byte(text + "\n")})
+		new.WriteString(text + "\n")
+	}
+	for _, line := range orig {
+		switch r := rnd.Intn(20); {
+		case r == 0:
+			lines = append(lines, hunkLine{'-', []byte(line + "\n")})
+		case r == 1:
+			lines = append(lines, hunkLine{'-', []byte(line + "\n")})
+			add(replacements[rnd.Intn(len(replacements))])
+		case r == 2:
+			lines = append(lines, hunkLine{' ', []byte(line + "\n")})
+			new.WriteString(line + "\n")
+			add(replacements[rnd.Intn(len(replacements))])
+		default:
+			lines = append(lines, hunkLine{' ', []byte(line + "\n")})
+			new.WriteString(line + "\n")
+		}
+	}
+	d, err := ShrinkContext(&FileDiff{Hunks: []*Hunk{buildHunk(0, 0, "", lines)}}, 3)
+	return d, new.String(), err
+}
+
+// applyDiff returns the file that d makes of orig.
+func applyDiff(d *FileDiff, orig string) (string, error) {
+	if len(d.Hunks) == 0 {
+		return orig, nil
+	}
+	// With the whole file as context, the diff has a single hunk.
+	full, err := ExpandContext(d, []byte(orig), -1)
+	if err != nil {
+		return "", err
+	}
+	return string(full.Hunks[0].NewText()), nil
+}
+
+func TestInterdiffFile_RepeatedContext(t *testing.T) {
+	// Functions with the same bodies give every change the same context
+	// as changes elsewhere.
+	var base []string
+	var baseText string
+	for _, name := range []string{"A", "B", "C", "D", "E", "F"} {
+		for _, line := range []string{"func " + name + "() error {", "\tx := 1", "\tif x > 0 {", "\t\treturn nil", "\t}", "\treturn nil", "}"} {
+			base = append(base, line)
+			baseText += line + "\n"
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 3000; i++ {
+		v1, new1, err := randomEdit(rnd, base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v2, new2, err := randomEdit(rnd, base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := InterdiffFile(v1, v2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := applyDiff(d, new1)
+		if err != nil || got != new2 {
+			p1, _ := PrintHunks(v1.Hunks)
+			p2, _ := PrintHunks(v2.Hunks)
+			p, _ := PrintHunks(d.Hunks)
+			t.Fatalf("case %d: interdiff does not turn v1's file into v2's (err %v)\nv1:\n%s\nv2:\n%s\ninterdiff:\n%s", i, err, p1, p2, p)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// A LineEnding is the line-ending style of a line, hunk or file.
+type LineEnding int
+
+const (
+	// LineEndingNone means there is no line ending: the line is the last
+	// line of a file without a trailing newline, or the hunk or file has
+	// no body lines.
+	LineEndingNone LineEnding = iota
+	// LineEndingLF is "\n".
+	LineEndingLF
+	// LineEndingCRLF is "\r\n".
+	LineEndingCRLF
+	// LineEndingMixed means both LF and CRLF lines are present.
+	LineEndingMixed
+)
+
+func (e LineEnding) String() string {
+	switch e {
+	case LineEndingNone:
+		return "none"
+	case LineEndingLF:
+		return "lf"
+	case LineEndingCRLF:
+		return "crlf"
+	case LineEndingMixed:
+		return "mixed"
+	}
+	return fmt.Sprintf("LineEnding(%d)", int(e))
+}
+
+func (e LineEnding) add(line LineEnding) LineEnding {
+	switch {
+	case line == LineEndingNone || line == e:
+		return e
+	case e == LineEndingNone:
+		return line
+	}
+	return LineEndingMixed
+}
+
+// LineEndings returns the line ending of each line of the hunk body, as it
+// was in the input. Carriage returns are found both in Body (when parsed
+// with ParseOptions.KeepCR) and in CRLFLines.
+func (h *Hunk) LineEndings() []LineEnding {
+	var endings []LineEnding
+	h.eachLine(func(i int32, line []byte, cr bool) {
+		e := LineEndingNone
+		if bytes.HasSuffix(line, []byte{'\n'}) {
+			e = LineEndingLF
+			if cr {
+				e = LineEndingCRLF
+			}
+		}
+		endings = append(endings, e)
+	})
+	return endings
+}
+
+// LineEnding returns the line-ending style of the hunk body.
+func (h *Hunk) LineEnding() LineEnding {
+	e := LineEndingNone
+	for _, line := range h.LineEndings() {
+		e = e.add(line)
+	}
+	return e
+}
+
+// LineEnding returns the line-ending style of the hunk bodies of the file
+// diff.
+func (d *FileDiff) LineEnding() LineEnding {
+	e := LineEndingNone
+	for _, h := range d.Hunks {
+		e = e.add(h.LineEnding())
+	}
+	return e
+}
+
+// eachLine calls f with the index of each body line, the line (including its
+// "\n", but not the "\r" of a "\r\n" ending) and whether it ended in a
+// carriage return.
+func (h *Hunk) eachLine(f func(i int32, line []byte, cr bool)) {
+	body := h.Body
+	crlf := h.CRLFLines
+	for i := int32(0); len(body) > 0; i++ {
+		n := bytes.IndexByte(body, '\n') + 1
+		if n == 0 {
+			n = len(body)
+		}
+		line := body[:n]
+		body = body[n:]
+
+		cr := false
+		for len(crlf) > 0 && crlf[0] < i {
+			crlf = crlf[1:]
+		}
+		if len(crlf) > 0 && crlf[0] == i {
+			// Any "\r" left in the line is part of its content.
+			cr = true
+		} else if bytes.HasSuffix(line, []byte("\r\n")) {
+			line = append(line[:len(line)-2:len(line)-2], '\n')
+			cr = true
+		}
+		f(i, line, cr)
+	}
+}
+
+// A LineEndingMode says how ConvertLineEndings (and printing with
+// PrintOptions) writes the line endings of hunk body lines.
+type LineEndingMode int
+
+const (
+	// LineEndingsAsIs leaves hunk bodies as they are stored.
+	LineEndingsAsIs LineEndingMode = iota
+	// LineEndingsPreserve reproduces the line ending each line had in the
+	// input, restoring the carriage returns recorded in Hunk.CRLFLines.
+	LineEndingsPreserve
+	// LineEndingsLF ends every line with "\n".
+	LineEndingsLF
+	// LineEndingsCRLF ends every line with "\r\n".
+	LineEndingsCRLF
+	// LineEndingsNormalize ends every line of a file with the line ending
+	// that is most common in its hunks (LF if there is a tie).
+	LineEndingsNormalize
+)
+
+// ConvertLineEndings returns a copy of d whose hunk bodies have their line
+// endings written according to mode. Carriage returns are kept in Body, so
+// the returned hunks have no CRLFLines. A last line without a newline is
+// left alone. ConvertLineEndings returns d itself for LineEndingsAsIs.
+func ConvertLineEndings(d *FileDiff, mode LineEndingMode) *FileDiff {
+	if mode == LineEndingsAsIs {
+		return d
+	}
+	if mode == LineEndingsNormalize {
+		var lf, crlf int
+		for _, h := range d.Hunks {
+			for _, e := range h.LineEndings() {
+				switch e {
+				case LineEndingLF:
+					lf++
+				case LineEndingCRLF:
+					crlf++
+				}
+			}
+		}
+		mode = LineEndingsLF
+		if crlf > lf {
+			mode = LineEndingsCRLF
+		}
+	}
+
+	c := *d
+	c.Hunks = nil
+	for _, h := range d.Hunks {
+		c.Hunks = append(c.Hunks, convertHunkLineEndings(h, mode))
+	}
+	return &c
+}
+
+// convertHunkLineEndings implements ConvertLineEndings for a single hunk.
+// mode must not be LineEndingsAsIs or LineEndingsNormalize.
+func convertHunkLineEndings(h *Hunk, mode LineEndingMode) *Hunk {
+	c := *h
+	c.Body = make([]byte, 0, len(h.Body))
+	c.CRLFLines = nil
+	c.OrigNoNewlineAt = 0
+	// Offsets into Body move as carriage returns are added or removed.
+	spans := append([]ColorSpan(nil), h.ColorSpans...)
+	var read int
+	h.eachLine(func(i int32, line []byte, cr bool) {
+		start := len(c.Body)
+		if !bytes.HasSuffix(line, []byte{'\n'}) {
+			if cr && mode == LineEndingsPreserve {
+				// The last line ended in a lone "\r".
+				line = append(line[:len(line):len(line)], '\r')
+			}
+			c.Body = append(c.Body, line...)
+		} else if mode == LineEndingsCRLF || (mode == LineEndingsPreserve && cr) {
+			c.Body = append(c.Body, line[:len(line)-1]...)
+			c.Body = append(c.Body, '\r', '\n')
+		} else {
+			c.Body = append(c.Body, line...)
+		}
+
+		n := bytes.IndexByte(h.Body[read:], '\n') + 1
+		if n == 0 {
+			n = len(h.Body) - read
+		}
+		end := read + n
+		for j := range spans {
+			if o := int(h.ColorSpans[j].Offset); o >= read && o < end {
+				spans[j].Offset = int32(start + o - read)
+			}
+		}
+		if h.OrigNoNewlineAt > 0 && int(h.OrigNoNewlineAt) == end {
+			c.OrigNoNewlineAt = int32(len(c.Body))
+		}
+		read = end
+	})
+	for j := range spans {
+		if int(h.ColorSpans[j].Offset) >= len(h.Body) {
+			spans[j].Offset = int32(len(c.Body))
+		}
+	}
+	if h.ColorSpans != nil {
+		c.ColorSpans = spans
+	}
+	return &c
+}
+
+// recordCRLF moves carriage returns at the end of lines of h's body into
+// CRLFLines, as parsing without ParseOptions.KeepCR does.
+func recordCRLF(h *Hunk) {
+	if bytes.IndexByte(h.Body, '\r') < 0 {
+		return
+	}
+	c := convertHunkLineEndings(h, LineEndingsLF)
+	var lines int32
+	h.eachLine(func(i int32, line []byte, cr bool) {
+		if cr {
+			c.CRLFLines = append(c.CRLFLines, i)
+		}
+		lines = i + 1
+	})
+	if bytes.HasSuffix(c.Body, []byte{'\r'}) && (len(c.CRLFLines) == 0 || c.CRLFLines[len(c.CRLFLines)-1] != lines-1) {
+		// The last line has no newline but ended in a lone "\r".
+		c.Body = c.Body[:len(c.Body)-1]
+		c.CRLFLines = append(c.CRLFLines, lines-1)
+	}
+	*h = *c
+}
@@ -0,0 +1,101 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const mixedLineEndingsDiff = "--- a.txt\r\n+++ a.txt\r\n@@ -1,3 +1,3 @@\r\n a\r\n-b\r\n+B\n c\r\n"
+
+func TestFileDiff_LineEnding(t *testing.T) {
+	wantEndings := []LineEnding{LineEndingCRLF, LineEndingCRLF, LineEndingLF, LineEndingCRLF}
+
+	for _, keepCR := range []bool{false, true} {
+		fd, err := ParseFileDiffOptions([]byte(mixedLineEndingsDiff), ParseOptions{KeepCR: keepCR})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fd.Hunks[0].LineEndings(); !reflect.DeepEqual(got, wantEndings) {
+			t.Errorf("KeepCR=%v: got line endings %v, want %v", keepCR, got, wantEndings)
+		}
+		if got := fd.LineEnding(); got != LineEndingMixed {
+			t.Errorf("KeepCR=%v: got file line ending %v, want %v", keepCR, got, LineEndingMixed)
+		}
+
+		var wantCRLFLines []int32
+		if !keepCR {
+			wantCRLFLines = []int32{0, 1, 3}
+		}
+		if got := fd.Hunks[0].CRLFLines; !reflect.DeepEqual(got, wantCRLFLines) {
+			t.Errorf("KeepCR=%v: got CRLFLines %v, want %v", keepCR, got, wantCRLFLines)
+		}
+	}
+}
+
+func TestPrintHunksOptions_LineEndings(t *testing.T) {
+	tests := map[LineEndingMode]string{
+		LineEndingsAsIs:      "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		LineEndingsPreserve:  "@@ -1,3 +1,3 @@\n a\r\n-b\r\n+B\n c\r\n",
+		LineEndingsLF:        "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		LineEndingsCRLF:      "@@ -1,3 +1,3 @@\n a\r\n-b\r\n+B\r\n c\r\n",
+		LineEndingsNormalize: "@@ -1,3 +1,3 @@\n a\r\n-b\r\n+B\r\n c\r\n",
+	}
+	fd, err := ParseFileDiff([]byte(mixedLineEndingsDiff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for mode, want := range tests {
+		got, err := PrintHunksOptions(fd.Hunks, PrintOptions{LineEndings: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("mode %d: got %q, want %q", mode, got, want)
+		}
+	}
+}
+
+func TestLineEndings_NoNewline(t *testing.T) {
+	input := "@@ -1,2 +1,1 @@\n-a\r\n-b\r\n\\ No newline at end of file\n+c\r\n\\ No newline at end of file\n"
+	hunks, err := ParseHunks([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int32{0, 1, 2}; !reflect.DeepEqual(hunks[0].CRLFLines, want) {
+		t.Errorf("got CRLFLines %v, want %v", hunks[0].CRLFLines, want)
+	}
+
+	got, err := PrintHunksOptions(hunks, PrintOptions{LineEndings: LineEndingsPreserve})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != input {
+		t.Errorf("got %q, want %q", got, input)
+	}
+}
+
+func TestReverseHunk_CRLFLines(t *testing.T) {
+	hunks, err := ParseHunks([]byte("@@ -1,3 +1,3 @@\n a\r\n-b\n+B\r\n c\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed, err := reverseHunk(hunks[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := " a\n-B\n+b\n c\n"; string(reversed.Body) != want {
+		t.Errorf("got body %q, want %q", reversed.Body, want)
+	}
+	if want := []int32{0, 1, 3}; !reflect.DeepEqual(reversed.CRLFLines, want) {
+		t.Errorf("got CRLFLines %v, want %v", reversed.CRLFLines, want)
+	}
+	roundTrip, err := reverseHunk(reversed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(roundTrip, hunks[0]) {
+		t.Errorf("double reverse did not restore hunk:\n%s", cmp.Diff(hunks[0], roundTrip))
+	}
+}
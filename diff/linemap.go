@@ -0,0 +1,118 @@
+package diff
+
+import "sort"
+
+// A LineMapper maps line numbers of the original file of a diff to line
+// numbers of the new file, using only the diff. Use Reverse to map the
+// other way.
+type LineMapper struct {
+	// blocks are the runs of changed lines, in order, with adjacent runs
+	// merged.
+	blocks []mapBlock
+}
+
+// A mapBlock is a run of lines of the file mapped from (from, and fromLen
+// lines) that is replaced by a run of lines of the other file (to, and toLen
+// lines). Lines are 0-indexed.
+type mapBlock struct {
+	from, fromLen int32
+	to, toLen     int32
+}
+
+// NewLineMapper returns a LineMapper that maps lines of d's original file to
+// its new file.
+func NewLineMapper(d *FileDiff) (*LineMapper, error) {
+	changes, err := hunkChanges(d.Hunks)
+	if err != nil {
+		return nil, err
+	}
+	m := &LineMapper{}
+	for _, c := range changes {
+		b := mapBlock{from: c.orig, fromLen: c.origLines(), to: c.new, toLen: c.newLines()}
+		if n := len(m.blocks); n > 0 && m.blocks[n-1].from+m.blocks[n-1].fromLen == b.from {
+			m.blocks[n-1].fromLen += b.fromLen
+			m.blocks[n-1].toLen += b.toLen
+			continue
+		}
+		m.blocks = append(m.blocks, b)
+	}
+	return m, nil
+}
+
+// Reverse returns a LineMapper that maps lines the other way.
+func (m *LineMapper) Reverse() *LineMapper {
+	r := &LineMapper{blocks: make([]mapBlock, len(m.blocks))}
+	for i, b := range m.blocks {
+		r.blocks[i] = mapBlock{from: b.to, fromLen: b.toLen, to: b.from, toLen: b.fromLen}
+	}
+	return r
+}
+
+// A MappedLine is where a line is on the other side of a diff.
+type MappedLine struct {
+	// Line is the 1-indexed line. If the line was deleted, it is the line
+	// that Before or After is, whichever is for the nearest line that was
+	// not (Before if they are as near).
+	Line int32
+	// Deleted is whether the line was deleted (or changed).
+	Deleted bool
+	// Before and After are, for a deleted line, where the nearest lines
+	// before and after it that were not deleted are. Before is 0 if the
+	// deleted line is at the start of the file.
+	Before, After int32
+}
+
+// Map returns where the 1-indexed line is on the other side of the diff.
+func (m *LineMapper) Map(line int32) MappedLine {
+	x := line - 1
+	// Find the first block that ends after the line.
+	i := sort.Search(len(m.blocks), func(i int) bool {
+		return m.blocks[i].from+m.blocks[i].fromLen > x
+	})
+	if i < len(m.blocks) && x >= m.blocks[i].from {
+		b := m.blocks[i]
+		ml := MappedLine{Deleted: true, Before: b.to, After: b.to + b.toLen + 1}
+		ml.Line = ml.Before
+		if ml.Before == 0 || b.from+b.fromLen-x < x-(b.from-1) {
+			ml.Line = ml.After
+		}
+		return ml
+	}
+	var delta int32
+	if i > 0 {
+		prev := m.blocks[i-1]
+		delta = (prev.to + prev.toLen) - (prev.from + prev.fromLen)
+	}
+	return MappedLine{Line: line + delta}
+}
+
+// MapRange returns the lines on the other side of the diff that the
+// 1-indexed lines from start to end (inclusive) correspond to: from the
+// first line of the range that was not deleted to the last one. ok is
+// false if all of the range was deleted.
+func (m *LineMapper) MapRange(start, end int32) (newStart, newEnd int32, ok bool) {
+	s, e := m.Map(start), m.Map(end)
+	newStart, newEnd = s.Line, e.Line
+	if s.Deleted {
+		newStart = s.After
+	}
+	if e.Deleted {
+		newEnd = e.Before
+	}
+	if newStart > newEnd {
+		return 0, 0, false
+	}
+	return newStart, newEnd, true
+}
+
+// MapPosition returns where a character position (a 1-indexed line and a
+// column) is on the other side of the diff. Only positions on lines that
+// the diff leaves alone can be mapped, so ok is false if the line was
+// deleted or changed. The column is unchanged.
+func (m *LineMapper) MapPosition(line, column int32) (newLine, newColumn int32, ok bool) {
+	ml := m.Map(line)
+	if ml.Deleted {
+		return 0, 0, false
+	}
+	return ml.Line, column, true
+}
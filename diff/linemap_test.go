@@ -0,0 +1,60 @@
+package diff
+
+import "testing"
+
+func TestLineMapper(t *testing.T) {
+	hunks, err := ParseHunks([]byte("@@ -1,6 +1,6 @@\n a\n+x\n b\n-c\n+C\n d\n-e\n f\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewLineMapper(&FileDiff{Hunks: hunks})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		m    *LineMapper
+		line int32
+		want MappedLine
+	}{
+		{m, 1, MappedLine{Line: 1}},
+		{m, 2, MappedLine{Line: 3}},
+		{m, 3, MappedLine{Line: 3, Deleted: true, Before: 3, After: 5}},
+		{m, 4, MappedLine{Line: 5}},
+		{m, 5, MappedLine{Line: 5, Deleted: true, Before: 5, After: 6}},
+		{m, 6, MappedLine{Line: 6}},
+		{m, 100, MappedLine{Line: 100}},
+		{m.Reverse(), 2, MappedLine{Line: 1, Deleted: true, Before: 1, After: 2}},
+		{m.Reverse(), 4, MappedLine{Line: 2, Deleted: true, Before: 2, After: 4}},
+		{m.Reverse(), 5, MappedLine{Line: 4}},
+		{m.Reverse(), 6, MappedLine{Line: 6}},
+	}
+	for _, test := range tests {
+		if got := test.m.Map(test.line); got != test.want {
+			t.Errorf("Map(%d): got %+v, want %+v", test.line, got, test.want)
+		}
+	}
+
+	for _, test := range []struct {
+		start, end       int32
+		newStart, newEnd int32
+		ok               bool
+	}{
+		{2, 3, 3, 3, true},
+		{3, 3, 0, 0, false},
+		{3, 5, 5, 5, true},
+		{1, 6, 1, 6, true},
+	} {
+		newStart, newEnd, ok := m.MapRange(test.start, test.end)
+		if newStart != test.newStart || newEnd != test.newEnd || ok != test.ok {
+			t.Errorf("MapRange(%d, %d): got %d, %d, %v", test.start, test.end, newStart, newEnd, ok)
+		}
+	}
+
+	if line, col, ok := m.MapPosition(4, 7); line != 5 || col != 7 || !ok {
+		t.Errorf("MapPosition(4, 7): got %d, %d, %v", line, col, ok)
+	}
+	if _, _, ok := m.MapPosition(3, 1); ok {
+		t.Error("MapPosition(3, 1): got ok for a deleted line")
+	}
+}
@@ -0,0 +1,305 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// A hunkLine is one line of a hunk body.
+type hunkLine struct {
+	// ' ' (context), '-' (only in the original file) or '+' (only in the
+	// new file)
+	op byte
+	// the line without its prefix, including its newline unless it is the
+	// last line of a file that does not end in one
+	text []byte
+}
+
+// hunkLines splits the body of h into lines. The newline that a Hunk keeps
+// after a '-' line at OrigNoNewlineAt is removed, and carriage returns
+// recorded in CRLFLines are restored. It returns an error if the body does
+// not match the line counts of h.
+func hunkLines(h *Hunk) ([]hunkLine, error) {
+	lines, err := bodyLines(h)
+	if err != nil {
+		return nil, err
+	}
+	var orig, new int32
+	for _, l := range lines {
+		if l.op != '+' {
+			orig++
+		}
+		if l.op != '-' {
+			new++
+		}
+	}
+	if orig != h.OrigLines || new != h.NewLines {
+		return nil, fmt.Errorf("hunk body has %d original and %d new lines, but its header says %d and %d", orig, new, h.OrigLines, h.NewLines)
+	}
+	return lines, nil
+}
+
+// bodyLines is like hunkLines, but does not check the line counts.
+func bodyLines(h *Hunk) ([]hunkLine, error) {
+	if len(h.CRLFLines) > 0 {
+		h = convertHunkLineEndings(h, LineEndingsPreserve)
+	}
+	var lines []hunkLine
+	for body, off := h.Body, 0; len(body) > 0; {
+		n := bytes.IndexByte(body, '\n') + 1
+		if n == 0 {
+			n = len(body)
+		}
+		line := body[:n]
+		body = body[n:]
+		off += n
+
+		l := hunkLine{op: line[0], text: line[1:]}
+		switch l.op {
+		case '\n':
+			// An empty context line whose leading space was lost.
+			l = hunkLine{op: ' ', text: line}
+		case '-':
+			if int(h.OrigNoNewlineAt) == off {
+				l.text = l.text[:len(l.text)-1]
+			}
+		case ' ', '+':
+		default:
+			return nil, fmt.Errorf("unexpected character %q at start of line", l.op)
+		}
+		lines = append(lines, l)
+	}
+	return lines, nil
+}
+
+// buildHunk returns the hunk made of lines, which start at the 0-indexed
+// lines origBegin and newBegin of the original and new files.
+func buildHunk(origBegin, newBegin int32, section string, lines []hunkLine) *Hunk {
+	h := &Hunk{Section: section}
+	for _, l := range lines {
+		if l.op != '+' {
+			h.OrigLines++
+		}
+		if l.op != '-' {
+			h.NewLines++
+		}
+		h.Body = append(h.Body, l.op)
+		h.Body = append(h.Body, l.text...)
+		if l.op == '-' && !bytes.HasSuffix(l.text, []byte{'\n'}) {
+			h.Body = append(h.Body, '\n')
+			h.OrigNoNewlineAt = int32(len(h.Body))
+		}
+	}
+	h.OrigStartLine = hunkStart(origBegin, h.OrigLines)
+	h.NewStartLine = hunkStart(newBegin, h.NewLines)
+	return h
+}
+
+// hunkBegin returns the 0-indexed line at which a hunk range with the given
+// start line and line count begins. An empty range's start line is the line
+// after which it is located.
+func hunkBegin(start, lines int32) int32 {
+	if lines == 0 {
+		return start
+	}
+	return start - 1
+}
+
+// hunkStart is the inverse of hunkBegin.
+func hunkStart(begin, lines int32) int32 {
+	if lines == 0 {
+		return begin
+	}
+	return begin + 1
+}
+
+// tidyChanges orders each run of changed lines so that its '-' lines come
+// before its '+' lines, as diff prints them, and makes the lines at the
+// start or end of a run that are removed and then added back unchanged
+// context lines.
+func tidyChanges(lines []hunkLine) []hunkLine {
+	tidy := make([]hunkLine, 0, len(lines))
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			tidy = append(tidy, lines[i])
+			i++
+			continue
+		}
+		j := i
+		var del, add []hunkLine
+		for ; j < len(lines) && lines[j].op != ' '; j++ {
+			if lines[j].op == '-' {
+				del = append(del, lines[j])
+			} else {
+				add = append(add, lines[j])
+			}
+		}
+		var tail []hunkLine
+		for len(del) > 0 && len(add) > 0 && bytes.Equal(del[0].text, add[0].text) {
+			tidy = append(tidy, hunkLine{' ', del[0].text})
+			del, add = del[1:], add[1:]
+		}
+		for len(del) > 0 && len(add) > 0 && bytes.Equal(del[len(del)-1].text, add[len(add)-1].text) {
+			tail = append(tail, hunkLine{' ', del[len(del)-1].text})
+			del, add = del[:len(del)-1], add[:len(add)-1]
+		}
+		tidy = append(tidy, del...)
+		tidy = append(tidy, add...)
+		for k := len(tail) - 1; k >= 0; k-- {
+			tidy = append(tidy, tail[k])
+		}
+		i = j
+	}
+	return tidy
+}
+
+// hasChanges reports whether any of lines is not a context line.
+func hasChanges(lines []hunkLine) bool {
+	for _, l := range lines {
+		if l.op != ' ' {
+			return true
+		}
+	}
+	return false
+}
+
+// anyCRLFLines reports whether any of hunks records carriage returns in
+// CRLFLines, in which case hunks derived from them should too (see
+// recordCRLF).
+func anyCRLFLines(hunks ...[]*Hunk) bool {
+	for _, hs := range hunks {
+		for _, h := range hs {
+			if len(h.CRLFLines) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// A change is a run of changed lines of a hunk, with the context lines
+// around it in the hunk.
+type change struct {
+	// orig and new are the 0-indexed lines of the original and new files
+	// at which the changed lines begin.
+	orig, new int32
+	// lines are the '-' and '+' lines.
+	lines []hunkLine
+	// before and after are the context lines before and after the changed
+	// lines, up to the previous and next change (or the hunk's ends).
+	before, after [][]byte
+	// section is the hunk's Section.
+	section string
+}
+
+// origLines returns the number of lines c removes.
+func (c *change) origLines() int32 {
+	var n int32
+	for _, l := range c.lines {
+		if l.op == '-' {
+			n++
+		}
+	}
+	return n
+}
+
+// newLines returns the number of lines c adds.
+func (c *change) newLines() int32 {
+	return int32(len(c.lines)) - c.origLines()
+}
+
+// hunkChanges splits hunks into their changes.
+func hunkChanges(hunks []*Hunk) ([]change, error) {
+	var changes []change
+	for _, h := range hunks {
+		lines, err := hunkLines(h)
+		if err != nil {
+			return nil, err
+		}
+		orig, new := hunkBegin(h.OrigStartLine, h.OrigLines), hunkBegin(h.NewStartLine, h.NewLines)
+		first := len(changes)
+		var context [][]byte
+		for i := 0; i < len(lines); {
+			if lines[i].op == ' ' {
+				context = append(context, lines[i].text)
+				orig++
+				new++
+				i++
+				continue
+			}
+			if len(changes) > first {
+				changes[len(changes)-1].after = context
+			}
+			c := change{orig: orig, new: new, before: context, section: h.Section}
+			for ; i < len(lines) && lines[i].op != ' '; i++ {
+				c.lines = append(c.lines, lines[i])
+			}
+			orig += c.origLines()
+			new += c.newLines()
+			changes = append(changes, c)
+			context = nil
+		}
+		if len(changes) > first {
+			changes[len(changes)-1].after = context
+		}
+	}
+	return changes, nil
+}
+
+// joinChanges returns the hunks made of changes, which must be in order.
+// Consecutive changes are put in the same hunk if their context lines
+// cover all the lines between them.
+func joinChanges(changes []change) []*Hunk {
+	var hunks []*Hunk
+	var lines []hunkLine
+	var orig, new int32
+	var section string
+	context := func(texts [][]byte) {
+		for _, text := range texts {
+			lines = append(lines, hunkLine{' ', text})
+		}
+	}
+	for i, c := range changes {
+		if i > 0 {
+			prev := &changes[i-1]
+			gap := int(c.orig - (prev.orig + prev.origLines()))
+			if gap <= len(prev.after)+len(c.before) {
+				if gap <= len(prev.after) {
+					context(prev.after[:gap])
+				} else {
+					context(prev.after)
+					context(c.before[len(c.before)-(gap-len(prev.after)):])
+				}
+				lines = append(lines, c.lines...)
+				continue
+			}
+			context(prev.after)
+			hunks = append(hunks, buildHunk(orig, new, section, lines))
+			lines = nil
+		}
+		orig, new = c.orig-int32(len(c.before)), c.new-int32(len(c.before))
+		section = c.section
+		context(c.before)
+		lines = append(lines, c.lines...)
+	}
+	if len(changes) > 0 {
+		context(changes[len(changes)-1].after)
+		hunks = append(hunks, buildHunk(orig, new, section, lines))
+	}
+	return hunks
+}
+
+// splitLines splits a file's contents into lines, each including its
+// newline (except for a last line without one).
+func splitLines(b []byte) [][]byte {
+	var lines [][]byte
+	for len(b) > 0 {
+		n := bytes.IndexByte(b, '\n') + 1
+		if n == 0 {
+			n = len(b)
+		}
+		lines = append(lines, b[:n:n])
+		b = b[n:]
+	}
+	return lines
+}
@@ -0,0 +1,174 @@
+package diff
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+)
+
+// ParseMultiFileDiffParallel parses a multi-file unified diff like
+// ParseMultiFileDiffOptions, but splits diff at file boundaries and parses
+// the pieces concurrently (see ParseOptions.Parallelism). The files are
+// returned in input order.
+//
+// Input that must be transformed before it can be split (with StripANSI,
+// KeepColorSpans or an Encoding set) is parsed sequentially.
+func ParseMultiFileDiffParallel(diff []byte, opts ParseOptions) ([]*FileDiff, error) {
+	workers := opts.Parallelism
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers == 1 || opts.StripANSI || opts.KeepColorSpans || opts.Encoding != EncodingNone ||
+		(opts.MaxTotalBytes > 0 && int64(len(diff)) > opts.MaxTotalBytes) {
+		return ParseMultiFileDiffOptions(diff, opts)
+	}
+
+	// Make a few chunks per worker, so that one large file does not leave
+	// the other workers idle.
+	chunks := splitMultiFileDiff(diff, len(diff)/(4*workers)+1, opts.KeepCR)
+	if len(chunks) == 1 {
+		return ParseMultiFileDiffOptions(diff, opts)
+	}
+
+	type result struct {
+		fds []*FileDiff
+		err error
+	}
+	results := make([]result, len(chunks))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(chunks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fds, err := ParseMultiFileDiffOptions(chunks[i].data, opts)
+				results[i] = result{fds, err}
+			}
+		}()
+	}
+	for i := range chunks {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var fds []*FileDiff
+	for i, res := range results {
+		if res.err != nil {
+			if e, ok := res.err.(*ParseError); ok {
+				// Report the position in the whole diff.
+				e.Line += chunks[i].line
+				e.Offset += chunks[i].offset
+			}
+			return nil, res.err
+		}
+		fds = append(fds, res.fds...)
+		if max := opts.MaxFiles; max > 0 && len(fds) > max {
+			return nil, &ParseError{chunks[i].line, chunks[i].offset, ErrTooManyFiles}
+		}
+	}
+	return fds, nil
+}
+
+// A diffChunk is a piece of a multi-file diff that starts at a file
+// boundary.
+type diffChunk struct {
+	data []byte
+	// line and offset (excluding newlines, as in ParseError) at which the
+	// chunk starts
+	line   int
+	offset int64
+}
+
+// splitMultiFileDiff splits diff into chunks of at least size bytes (except
+// for the last) at the file boundaries found by a boundaryScanner.
+func splitMultiFileDiff(diff []byte, size int, keepCR bool) []diffChunk {
+	var chunks []diffChunk
+	var start, startLine int
+	s := boundaryScanner{keepCR: keepCR}
+	for pos := 0; pos < len(diff); {
+		end := bytes.IndexByte(diff[pos:], '\n') + 1
+		if end == 0 {
+			end = len(diff) - pos
+		}
+		if b, line, ok := s.scan(diff[pos : pos+end]); ok && int(b)-start >= size {
+			chunks = append(chunks, diffChunk{data: diff[start:b], line: startLine, offset: int64(start - startLine)})
+			start, startLine = int(b), line
+		}
+		pos += end
+	}
+	return append(chunks, diffChunk{data: diff[start:], line: startLine, offset: int64(start - startLine)})
+}
+
+// A boundaryScanner finds the file boundaries in a multi-file diff, one
+// line at a time. A boundary is the first line after a hunk that the hunks
+// reader would not take as part of the hunk, which is where
+// MultiFileDiffReader starts reading the next file, so parsing the diff in
+// pieces split at boundaries gives the same files as parsing it as a whole.
+type boundaryScanner struct {
+	keepCR bool
+
+	// position of the next line
+	pos  int64
+	line int
+
+	// inHunk is whether the previous line was part of a hunk, and
+	// sawFileHeader whether a "+++" line was seen outside of a hunk (so an
+	// "@@" line in, e.g., a commit message is not taken as a hunk).
+	inHunk, sawFileHeader bool
+
+	// pending is the number of lines scanned since a "---" line in a hunk,
+	// which starts a file header if the next lines are "+++" and "@@"
+	// lines (0 if there is no such line).
+	pending     int
+	pendingPos  int64
+	pendingLine int
+
+	// hunkStart is whether the last line scanned was a hunk header.
+	hunkStart bool
+}
+
+// scan scans the next line, including its newline (if any). If it finds a
+// boundary, it returns its byte offset and line number.
+func (s *boundaryScanner) scan(raw []byte) (pos int64, line int, ok bool) {
+	linePos, lineNum := s.pos, s.line
+	s.pos += int64(len(raw))
+	s.line++
+	s.hunkStart = false
+
+	text := bytes.TrimSuffix(raw, []byte{'\n'})
+	if !s.keepCR {
+		text = dropCR(text)
+	}
+
+	if s.pending > 0 {
+		s.pending++
+		switch {
+		case s.pending == 2 && bytes.HasPrefix(text, []byte("+++")):
+			return 0, 0, false
+		case s.pending == 3 && bytes.HasPrefix(text, hunkPrefix):
+			s.pending = 0
+			s.hunkStart = true
+			return s.pendingPos, s.pendingLine, true
+		}
+		s.pending = 0
+	}
+
+	switch {
+	case bytes.HasPrefix(text, hunkPrefix):
+		if s.inHunk || s.sawFileHeader {
+			s.inHunk, s.hunkStart = true, true
+		}
+	case !s.inHunk:
+		if bytes.HasPrefix(text, []byte("+++ ")) {
+			s.sawFileHeader = true
+		}
+	case len(text) > 0 && !linePrefix(text[0]):
+		s.inHunk, s.sawFileHeader = false, false
+		return linePos, lineNum, true
+	case bytes.HasPrefix(text, []byte("---")):
+		s.pending, s.pendingPos, s.pendingLine = 1, linePos, lineNum
+	}
+	return 0, 0, false
+}
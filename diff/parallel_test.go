@@ -0,0 +1,85 @@
+package diff
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseMultiFileDiffParallel(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "*.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fixture := range fixtures {
+		t.Run(filepath.Base(fixture), func(t *testing.T) {
+			data, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Repeat the fixture so that there is something to split.
+			data = bytes.Repeat(data, 5)
+
+			want, wantErr := ParseMultiFileDiff(data)
+			got, err := ParseMultiFileDiffParallel(data, ParseOptions{Parallelism: 8})
+			if (err != nil) != (wantErr != nil) {
+				t.Fatalf("got err %v, want %v", err, wantErr)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got - want:\n%s", cmp.Diff(want, got))
+			}
+		})
+	}
+}
+
+func TestSplitMultiFileDiff(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sample_multi_file.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := splitMultiFileDiff(data, 1, false)
+	if len(chunks) != 2 {
+		t.Fatalf("got %d chunks, want 2", len(chunks))
+	}
+	if !bytes.HasPrefix(chunks[1].data, []byte("diff ")) {
+		t.Errorf("second chunk starts with %q, want a diff line", chunks[1].data[:20])
+	}
+	var joined []byte
+	for _, c := range chunks {
+		if got := bytes.Count(joined, []byte{'\n'}); c.line != got {
+			t.Errorf("got chunk line %d, want %d", c.line, got)
+		}
+		joined = append(joined, c.data...)
+	}
+	if !bytes.Equal(joined, data) {
+		t.Error("chunks do not add up to the input")
+	}
+}
+
+func TestParseMultiFileDiffParallel_Errors(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sample_multi_file.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Repeat(data, 3)
+
+	_, err = ParseMultiFileDiffParallel(data, ParseOptions{Parallelism: 4, MaxFiles: 5})
+	if !errors.Is(err, ErrTooManyFiles) {
+		t.Errorf("got err %v, want ErrTooManyFiles", err)
+	}
+
+	bad := append(append([]byte{}, data...), "diff --git a/x b/x\n--- a/x\n+++ b/x\n@@ -1,a +1,1 @@\n"...)
+	_, err = ParseMultiFileDiffParallel(bad, ParseOptions{Parallelism: 4})
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("got err %v, want a ParseError", err)
+	}
+	if min := bytes.Count(data, []byte{'\n'}); perr.Line <= min {
+		t.Errorf("got error on line %d, want a line after %d", perr.Line, min)
+	}
+}
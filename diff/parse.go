@@ -2,10 +2,12 @@ package diff
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"path/filepath"
+	"math"
+	"path"
 	"strconv"
 	"strings"
 	"time"
@@ -24,6 +26,12 @@ func ParseMultiFileDiffOptions(diff []byte, opts ParseOptions) ([]*FileDiff, err
 	return NewMultiFileDiffReaderOptions(bytes.NewReader(diff), opts).ReadAllFiles()
 }
 
+// ParseMultiFileDiffContext parses a multi-file unified diff with the given
+// options, stopping with ctx's error (in a ParseError) if ctx is done.
+func ParseMultiFileDiffContext(ctx context.Context, diff []byte, opts ParseOptions) ([]*FileDiff, error) {
+	return NewMultiFileDiffReaderContext(ctx, bytes.NewReader(diff), opts).ReadAllFiles()
+}
+
 // NewMultiFileDiffReader returns a new MultiFileDiffReader that reads
 // a multi-file unified diff from r.
 func NewMultiFileDiffReader(r io.Reader) *MultiFileDiffReader {
@@ -33,7 +41,14 @@ func NewMultiFileDiffReader(r io.Reader) *MultiFileDiffReader {
 // NewMultiFileDiffReaderOptions returns a new MultiFileDiffReader that reads
 // a multi-file unified diff from r with the given options.
 func NewMultiFileDiffReaderOptions(r io.Reader, opts ParseOptions) *MultiFileDiffReader {
-	return &MultiFileDiffReader{reader: newLineReaderOptions(r, opts)}
+	return &MultiFileDiffReader{reader: newLineReaderOptions(r, opts), opts: opts}
+}
+
+// NewMultiFileDiffReaderContext returns a new MultiFileDiffReader that reads
+// a multi-file unified diff from r with the given options. Reading stops
+// with ctx's error (in a ParseError) once ctx is done.
+func NewMultiFileDiffReaderContext(ctx context.Context, r io.Reader, opts ParseOptions) *MultiFileDiffReader {
+	return &MultiFileDiffReader{reader: newLineReaderContext(ctx, r, opts), opts: opts}
 }
 
 // MultiFileDiffReader reads a multi-file unified diff.
@@ -41,9 +56,20 @@ type MultiFileDiffReader struct {
 	line   int
 	offset int64
 	reader *lineReader
+	opts   ParseOptions
 
 	// TODO(sqs): line and offset tracking in multi-file diffs is broken; add tests and fix
 
+	// epilogue is the non-diff content that followed the last file.
+	epilogue []string
+
+	// files is the number of files read so far (see ParseOptions.MaxFiles).
+	files int
+
+	// buf is passed from one file's HunksReader to the next, so that the
+	// hunk bodies of all files share buffers (see HunksReader.buf).
+	buf []byte
+
 	// nextFileFirstLine is a line that was read by a HunksReader that
 	// was how it determined the hunk was complete. But to determine
 	// that, it needed to read the first line of the next file. We
@@ -62,48 +88,88 @@ func (r *MultiFileDiffReader) ReadFile() (*FileDiff, error) {
 
 // ReadFileWithTrailingContent reads the next file unified diff (including
 // headers and all hunks) from r, also returning any trailing content. If there
-// are no more files in the diff, it returns error io.EOF.
+// are no more files in the diff, it returns error io.EOF. The trailing content
+// is the epilogue (see Epilogue) joined by newlines.
 func (r *MultiFileDiffReader) ReadFileWithTrailingContent() (*FileDiff, string, error) {
+	fd, trailing, err := r.readFileWithTrailingContent()
+	if fd != nil {
+		if err := r.countFile(); err != nil {
+			return nil, "", err
+		}
+	}
+	return fd, trailing, err
+}
+
+// countFile counts a file that was read, returning an error if there are
+// more than ParseOptions.MaxFiles.
+func (r *MultiFileDiffReader) countFile() error {
+	r.files++
+	if max := r.opts.MaxFiles; max > 0 && r.files > max {
+		return &ParseError{r.line, r.offset, ErrTooManyFiles}
+	}
+	return nil
+}
+
+func (r *MultiFileDiffReader) readFileWithTrailingContent() (*FileDiff, string, error) {
+	fd, hr, trailing, err := r.readFileHeaders()
+	if hr == nil || err != nil {
+		return fd, trailing, err
+	}
+	fd.Hunks, err = hr.ReadAllHunks()
+	fd.InvalidUTF8 = !hunksValidUTF8(fd.Hunks)
+	if err := r.endHunks(hr, err); err != nil {
+		return nil, "", err
+	}
+	return fd, "", nil
+}
+
+// readFileHeaders reads the headers of the next file. If the file has
+// hunks, it returns a HunksReader to read them with, after which endHunks
+// must be called. At the end of the diff, it returns io.EOF and the
+// trailing content (see ReadFileWithTrailingContent).
+func (r *MultiFileDiffReader) readFileHeaders() (fd *FileDiff, hr *HunksReader, trailing string, err error) {
 	fr := &FileDiffReader{
 		line:           r.line,
 		offset:         r.offset,
 		reader:         r.reader,
+		opts:           r.opts,
 		fileHeaderLine: r.nextFileFirstLine,
 	}
 	r.nextFileFirstLine = nil
 
-	fd, err := fr.ReadAllHeaders()
+	fd, err = fr.ReadAllHeaders()
 	if err != nil {
 		switch e := err.(type) {
 		case *ParseError:
 			if e.Err == ErrNoFileHeader || e.Err == ErrExtendedHeadersEOF {
 				// Any non-diff content preceding a valid diff is included in the
-				// extended headers of the following diff. In this way, mixed diff /
+				// preamble of the following diff. In this way, mixed diff /
 				// non-diff content can be parsed. Trailing non-diff content is
 				// different: it doesn't make sense to return a FileDiff with only
-				// extended headers populated. Instead, we return any trailing content
-				// in case the caller needs it.
-				trailing := ""
+				// a preamble populated. Instead, we keep any trailing content as
+				// the epilogue and return it in case the caller needs it.
+				r.epilogue = nil
 				if fd != nil {
-					trailing = strings.Join(fd.Extended, "\n")
+					r.epilogue = append(append(r.epilogue, fd.Preamble...), fd.Extended...)
 				}
-				return nil, trailing, io.EOF
+				return nil, nil, strings.Join(r.epilogue, "\n"), io.EOF
 			}
-			return nil, "", err
+			return nil, nil, "", err
 
 		case OverflowError:
 			r.nextFileFirstLine = []byte(e)
-			return fd, "", nil
+			return fd, nil, "", nil
 
 		default:
-			return nil, "", err
+			return nil, nil, "", err
 		}
 	}
 
-	// FileDiff is added/deleted file
+	// FileDiff is an "Only in", "Common subdirectories" or "Files
+	// differ" message from a recursive diff.
 	// No further collection of hunks needed
-	if fd.NewName == "" {
-		return fd, "", nil
+	if fd.Kind != KindUnified {
+		return fd, nil, "", nil
 	}
 
 	// Before reading hunks, check to see if there are any. If there
@@ -112,35 +178,48 @@ func (r *MultiFileDiffReader) ReadFileWithTrailingContent() (*FileDiff, string,
 	// not easy for us to tell from that error alone if that was
 	// caused by the lack of any hunks, or a malformatted hunk, so we
 	// need to perform the check here.
-	hr := fr.HunksReader()
 	line, err := r.reader.readLine()
 	if err != nil && err != io.EOF {
-		return fd, "", err
+		return fd, nil, "", err
 	}
 	line = bytes.TrimSuffix(line, []byte{'\n'})
-	if bytes.HasPrefix(line, hunkPrefix) {
-		hr.nextHunkHeaderLine = line
-		fd.Hunks, err = hr.ReadAllHunks()
-		r.line = fr.line
-		r.offset = fr.offset
-		if err != nil {
-			if e0, ok := err.(*ParseError); ok {
-				if e, ok := e0.Err.(*ErrBadHunkLine); ok {
-					// This just means we finished reading the hunks for the
-					// current file. See the ErrBadHunkLine doc for more info.
-					r.nextFileFirstLine = e.Line
-					return fd, "", nil
-				}
-			}
-			return nil, "", err
-		}
-	} else {
+	if !bytes.HasPrefix(line, hunkPrefix) {
 		// There weren't any hunks, so that line we peeked ahead at
 		// actually belongs to the next file. Put it back.
 		r.nextFileFirstLine = line
+		return fd, nil, "", nil
 	}
+	hr = fr.HunksReader()
+	hr.buf = r.buf
+	hr.nextHunkHeaderLine = line
+	r.line = fr.line
+	r.offset = fr.offset
+	return fd, hr, "", nil
+}
 
-	return fd, "", nil
+// endHunks finishes reading a file's hunks with hr, which stopped with err.
+func (r *MultiFileDiffReader) endHunks(hr *HunksReader, err error) error {
+	r.buf = hr.buf
+	if err != nil {
+		if e0, ok := err.(*ParseError); ok {
+			if e, ok := e0.Err.(*ErrBadHunkLine); ok {
+				// This just means we finished reading the hunks for the
+				// current file. See the ErrBadHunkLine doc for more info.
+				r.nextFileFirstLine = e.Line
+				return nil
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// Epilogue returns the lines of non-diff content that followed the last
+// file in the diff (e.g., a signature or log output). It is only set once
+// ReadFile has returned io.EOF. Non-diff content that precedes a file is
+// available as that FileDiff's Preamble instead.
+func (r *MultiFileDiffReader) Epilogue() []string {
+	return r.epilogue
 }
 
 // ReadAllFiles reads all file unified diffs (including headers and all
@@ -171,6 +250,12 @@ func ParseFileDiffOptions(diff []byte, opts ParseOptions) (*FileDiff, error) {
 	return NewFileDiffReaderOptions(bytes.NewReader(diff), opts).Read()
 }
 
+// ParseFileDiffContext parses a file unified diff with the given options,
+// stopping with ctx's error (in a ParseError) if ctx is done.
+func ParseFileDiffContext(ctx context.Context, diff []byte, opts ParseOptions) (*FileDiff, error) {
+	return NewFileDiffReaderContext(ctx, bytes.NewReader(diff), opts).Read()
+}
+
 // NewFileDiffReader returns a new FileDiffReader that reads a file
 // unified diff.
 func NewFileDiffReader(r io.Reader) *FileDiffReader {
@@ -180,7 +265,14 @@ func NewFileDiffReader(r io.Reader) *FileDiffReader {
 // NewFileDiffReaderOptions returns a new FileDiffReader that reads a file
 // unified diff with the given options.
 func NewFileDiffReaderOptions(r io.Reader, opts ParseOptions) *FileDiffReader {
-	return &FileDiffReader{reader: newLineReaderOptions(r, opts)}
+	return &FileDiffReader{reader: newLineReaderOptions(r, opts), opts: opts}
+}
+
+// NewFileDiffReaderContext returns a new FileDiffReader that reads a file
+// unified diff with the given options. Reading stops with ctx's error (in a
+// ParseError) once ctx is done.
+func NewFileDiffReaderContext(ctx context.Context, r io.Reader, opts ParseOptions) *FileDiffReader {
+	return &FileDiffReader{reader: newLineReaderContext(ctx, r, opts), opts: opts}
 }
 
 // FileDiffReader reads a unified file diff.
@@ -188,6 +280,7 @@ type FileDiffReader struct {
 	line   int
 	offset int64
 	reader *lineReader
+	opts   ParseOptions
 
 	// fileHeaderLine is the first file header line, set by:
 	//
@@ -210,6 +303,7 @@ func (r *FileDiffReader) Read() (*FileDiff, error) {
 	if err != nil {
 		return nil, err
 	}
+	fd.InvalidUTF8 = !hunksValidUTF8(fd.Hunks)
 
 	return fd, nil
 }
@@ -224,6 +318,7 @@ func (r *FileDiffReader) ReadAllHeaders() (*FileDiff, error) {
 	fd := &FileDiff{}
 
 	fd.Extended, err = r.ReadExtendedHeaders()
+	fd.Preamble, fd.Extended = splitPreamble(fd.Extended)
 	if pe, ok := err.(*ParseError); ok && pe.Err == ErrExtendedHeadersEOF {
 		wasEmpty := handleEmpty(fd)
 		if wasEmpty {
@@ -237,17 +332,22 @@ func (r *FileDiffReader) ReadAllHeaders() (*FileDiff, error) {
 		return fd, err
 	}
 
-	var origTime, newTime *time.Time
-	fd.OrigName, fd.NewName, origTime, newTime, err = r.ReadFileHeaders()
+	if r.fileHeaderLine != nil {
+		if kind, origName, newName, ok := parseDirMessage(r.fileHeaderLine); ok {
+			r.line++
+			r.offset += int64(len(r.fileHeaderLine))
+			r.fileHeaderLine = nil
+			fd.Kind, fd.OrigName, fd.NewName = kind, origName, newName
+			return fd, nil
+		}
+	}
+
+	orig, new, err := r.readFileHeaders()
 	if err != nil {
 		return nil, err
 	}
-	if origTime != nil {
-		fd.OrigTime = origTime
-	}
-	if newTime != nil {
-		fd.NewTime = newTime
-	}
+	fd.OrigName, fd.OrigTime, fd.OrigTimeLayout, fd.OrigLabel = orig.name, orig.time, orig.timeLayout, orig.label
+	fd.NewName, fd.NewTime, fd.NewTimeLayout, fd.NewLabel = new.name, new.time, new.timeLayout, new.label
 
 	return fd, nil
 }
@@ -261,6 +361,7 @@ func (r *FileDiffReader) HunksReader() *HunksReader {
 		line:   r.line,
 		offset: r.offset,
 		reader: r.reader,
+		opts:   r.opts,
 	}
 }
 
@@ -269,46 +370,64 @@ func (r *FileDiffReader) HunksReader() *HunksReader {
 // timestamps). Or which starts with "Only in " with dir path and filename.
 // "Only in" message is supported in POSIX locale: https://pubs.opengroup.org/onlinepubs/9699919799/utilities/diff.html#tag_20_34_10
 func (r *FileDiffReader) ReadFileHeaders() (origName, newName string, origTimestamp, newTimestamp *time.Time, err error) {
+	orig, new, err := r.readFileHeaders()
+	if err != nil {
+		return "", "", nil, nil, err
+	}
+	return orig.name, new.name, orig.time, new.time, nil
+}
+
+// A fileHeader is one of the "---" or "+++" file header lines.
+type fileHeader struct {
+	name       string
+	time       *time.Time
+	timeLayout string // empty if diffTimeFormatLayout
+	label      string // text after the name that is not a timestamp
+}
+
+// readFileHeaders reads both file header lines (see ReadFileHeaders).
+func (r *FileDiffReader) readFileHeaders() (orig, new fileHeader, err error) {
 	if r.fileHeaderLine != nil {
 		if isOnlyMessage, source, filename := parseOnlyInMessage(r.fileHeaderLine); isOnlyMessage {
-			return filepath.Join(string(source), string(filename)),
-				"", nil, nil, nil
+			return fileHeader{name: path.Join(string(source), string(filename))}, fileHeader{}, nil
 		}
 	}
-	origName, origTimestamp, err = r.readOneFileHeader([]byte("--- "))
+	orig, err = r.readOneFileHeader([]byte("--- "))
 	if err != nil {
-		return "", "", nil, nil, err
+		return fileHeader{}, fileHeader{}, err
 	}
 
-	newName, newTimestamp, err = r.readOneFileHeader([]byte("+++ "))
+	new, err = r.readOneFileHeader([]byte("+++ "))
 	if err != nil {
-		return "", "", nil, nil, err
+		return fileHeader{}, fileHeader{}, err
 	}
 
-	unquotedOrigName, err := strconv.Unquote(origName)
-	if err == nil {
-		origName = unquotedOrigName
-	}
-	unquotedNewName, err := strconv.Unquote(newName)
-	if err == nil {
-		newName = unquotedNewName
-	}
+	orig.name = unquoteFileName(orig.name)
+	new.name = unquoteFileName(new.name)
 
-	return origName, newName, origTimestamp, newTimestamp, nil
+	return orig, new, nil
+}
+
+// unquoteFileName unquotes a file name from a file header if it is quoted.
+func unquoteFileName(name string) string {
+	if unquoted, err := strconv.Unquote(name); err == nil {
+		return unquoted
+	}
+	return name
 }
 
 // readOneFileHeader reads one of the file headers (prefix should be
 // either "+++ " or "--- ").
-func (r *FileDiffReader) readOneFileHeader(prefix []byte) (filename string, timestamp *time.Time, err error) {
+func (r *FileDiffReader) readOneFileHeader(prefix []byte) (fileHeader, error) {
 	var line []byte
 
 	if r.fileHeaderLine == nil {
 		var err error
 		line, err = r.reader.readLine()
 		if err == io.EOF {
-			return "", nil, &ParseError{r.line, r.offset, ErrNoFileHeader}
+			return fileHeader{}, &ParseError{r.line, r.offset, ErrNoFileHeader}
 		} else if err != nil {
-			return "", nil, err
+			return fileHeader{}, err
 		}
 	} else {
 		line = r.fileHeaderLine
@@ -316,32 +435,73 @@ func (r *FileDiffReader) readOneFileHeader(prefix []byte) (filename string, time
 	}
 
 	if !bytes.HasPrefix(line, prefix) {
-		return "", nil, &ParseError{r.line, r.offset, ErrBadFileHeader}
+		return fileHeader{}, &ParseError{r.line, r.offset, ErrBadFileHeader}
 	}
 
 	r.offset += int64(len(line))
 	r.line++
-	line = line[len(prefix):]
+	return parseFileHeaderLine(line[len(prefix):], r.opts.TimeLayouts), nil
+}
 
+// parseFileHeaderLine parses the text after the "--- " or "+++ " of a file
+// header line, using layouts (DefaultTimeLayouts if nil) for the timestamp.
+func parseFileHeaderLine(line []byte, layouts []string) fileHeader {
 	trimmedLine := strings.TrimSpace(string(line)) // filenames that contain spaces may be terminated by a tab
-	parts := strings.SplitN(trimmedLine, "\t", 2)
-	filename = parts[0]
-	if len(parts) == 2 {
-		var ts time.Time
-		// Timestamp is optional, but this header has it.
-		ts, err = time.Parse(diffTimeParseLayout, parts[1])
-		if err != nil {
-			var err1 error
-			ts, err1 = time.Parse(diffTimeParseWithoutTZLayout, parts[1])
-			if err1 != nil {
-				return "", nil, err
+	name, stamp, ok := strings.Cut(trimmedLine, "\t")
+	h := fileHeader{name: name}
+	if ok {
+		// Timestamp is optional, but this header has it (or has some
+		// other label, which we keep as is).
+		if layouts == nil {
+			layouts = DefaultTimeLayouts
+		}
+		if ts, layout, ok := parseTimestamp(stamp, layouts); ok {
+			h.time = ts
+			if layout != diffTimeFormatLayout {
+				h.timeLayout = layout
 			}
-			err = nil
+		} else {
+			h.label = stamp
+		}
+	}
+	return h
+}
+
+// parseTimestamp parses text with the first of layouts that reproduces text
+// exactly when formatting the result, so that printing the timestamp again
+// preserves its style. If no layout round-trips, the first layout that
+// parses text at all is used.
+func parseTimestamp(text string, layouts []string) (timestamp *time.Time, layout string, ok bool) {
+	var buf [64]byte
+	var first time.Time
+	for _, l := range layouts {
+		ts, err := time.Parse(l, text)
+		if err != nil || !zoneKnown(ts) {
+			continue
+		}
+		if string(ts.AppendFormat(buf[:0], l)) == text {
+			return &ts, l, true
 		}
-		timestamp = &ts
+		if layout == "" {
+			first, layout = ts, l
+		}
+	}
+	if layout == "" {
+		return nil, "", false
 	}
+	return &first, layout, true
+}
 
-	return filename, timestamp, err
+// zoneKnown reports whether time.Parse knew the offset of ts's time zone.
+// It gives a zone abbreviation that is neither UTC nor one of the local time
+// zone's (such as "PDT" on a machine in another zone) a zero offset, which
+// would silently give the wrong instant.
+func zoneKnown(ts time.Time) bool {
+	if loc := ts.Location(); loc == time.UTC || loc == time.Local {
+		return true
+	}
+	name, _ := ts.Zone()
+	return name == "" || strings.HasPrefix(name, "GMT")
 }
 
 // OverflowError is returned when we have overflowed into the start
@@ -356,17 +516,36 @@ func (e OverflowError) Error() string {
 // unified diff file (e.g., git's "diff --git a/foo.go b/foo.go", "new
 // mode <mode>", "rename from <path>", etc.).
 func (r *FileDiffReader) ReadExtendedHeaders() ([]string, error) {
-	var xheaders []string
+	// The headers are collected in one buffer and converted to strings
+	// together when done, to save an allocation per line.
+	buf := make([]byte, 0, 512)
+	var ends []int
+	xheaders := func() []string {
+		if len(ends) == 0 {
+			return nil
+		}
+		all := string(buf)
+		headers := make([]string, len(ends))
+		start := 0
+		for i, end := range ends {
+			headers[i] = all[start:end]
+			start = end
+		}
+		return headers
+	}
+	// firstLine is whether no "diff --git" line has been read yet. Lines
+	// before it are the preamble (see splitPreamble).
 	firstLine := true
+	inBinaryPatch := false
 	for {
 		var line []byte
 		if r.fileHeaderLine == nil {
 			var err error
 			line, err = r.reader.readLine()
 			if err == io.EOF {
-				return xheaders, &ParseError{r.line, r.offset, ErrExtendedHeadersEOF}
+				return xheaders(), &ParseError{r.line, r.offset, ErrExtendedHeadersEOF}
 			} else if err != nil {
-				return xheaders, err
+				return xheaders(), err
 			}
 		} else {
 			line = r.fileHeaderLine
@@ -377,25 +556,73 @@ func (r *FileDiffReader) ReadExtendedHeaders() ([]string, error) {
 			if firstLine {
 				firstLine = false
 			} else {
-				return xheaders, OverflowError(line)
+				return xheaders(), OverflowError(line)
 			}
 		}
 		if bytes.HasPrefix(line, []byte("--- ")) {
 			// We've reached the file header.
 			r.fileHeaderLine = line // pass to readOneFileHeader (see fileHeaderLine field doc)
-			return xheaders, nil
+			return xheaders(), nil
 		}
 
-		// Reached message that file is added/deleted
-		if isOnlyInMessage, _, _ := parseOnlyInMessage(line); isOnlyInMessage {
-			r.fileHeaderLine = line // pass to readOneFileHeader (see fileHeaderLine field doc)
-			return xheaders, nil
+		// Reached a message from a recursive diff that stands in for the
+		// file header (e.g., a file is only present on one side).
+		if isDirMessage(line, !firstLine) {
+			r.fileHeaderLine = line // pass to ReadAllHeaders (see fileHeaderLine field doc)
+			return xheaders(), nil
+		}
+
+		if !firstLine && !inBinaryPatch && !isGitExtendedHeader(line) && !bytes.HasPrefix(line, []byte("diff --git ")) {
+			// The git extended headers of an empty file diff (which has no
+			// ---/+++ header) are over, so this line is the preamble of the
+			// next file.
+			return xheaders(), OverflowError(line)
+		}
+		if bytes.HasPrefix(line, []byte("GIT binary patch")) {
+			// The binary patch data that follows can't be told apart
+			// from other content.
+			inBinaryPatch = true
 		}
 
 		r.line++
 		r.offset += int64(len(line))
-		xheaders = append(xheaders, string(line))
+		buf = append(buf, line...)
+		ends = append(ends, len(buf))
+	}
+}
+
+// gitExtendedHeaderPrefixes are the prefixes of the lines git may write
+// between a "diff --git" line and the file header: all the headers written
+// by diff.c and (for combined diffs of merges) combine-diff.c in git's
+// source.
+// See https://git-scm.com/docs/diff-format#generate_patch_text_with_p and
+// https://git-scm.com/docs/diff-format#_combined_diff_format.
+var gitExtendedHeaderPrefixes = [][]byte{
+	[]byte("old mode "),
+	[]byte("new mode "),
+	[]byte("deleted file mode "), // also "deleted file mode <mode>,<mode>" in combined diffs
+	[]byte("new file mode "),
+	[]byte("copy from "),
+	[]byte("copy to "),
+	[]byte("rename from "),
+	[]byte("rename to "),
+	[]byte("similarity index "),
+	[]byte("dissimilarity index "),
+	[]byte("index "), // also "index <hash>,<hash>..<hash>" in combined diffs
+	[]byte("mode "),  // "mode <mode>,<mode>..<mode>" in combined diffs
+	[]byte("Binary files "),
+	[]byte("GIT binary patch"),
+}
+
+// isGitExtendedHeader reports whether line is one of git's extended header
+// lines.
+func isGitExtendedHeader(line []byte) bool {
+	for _, prefix := range gitExtendedHeaderPrefixes {
+		if bytes.HasPrefix(line, prefix) {
+			return true
+		}
 	}
+	return false
 }
 
 // readQuotedFilename extracts a quoted filename from the beginning of a string,
@@ -504,6 +731,24 @@ func parseDiffGitArgs(diffArgs string) (string, string, bool) {
 	return diffArgs[:i-1], second, true
 }
 
+// splitPreamble splits the lines read before a file header into the
+// preamble, which is any non-diff content (a commit message, an "Index:"
+// banner, etc.), and the extended headers, which start at the first "diff "
+// command line (e.g., "diff --git a/f b/f" or "diff -u a/f b/f"). Plain
+// unified diffs have no such line, so everything before their file header
+// is preamble.
+func splitPreamble(lines []string) (preamble, extended []string) {
+	for i, line := range lines {
+		if strings.HasPrefix(line, "diff ") {
+			if i == 0 {
+				return nil, lines
+			}
+			return lines[:i], lines[i:]
+		}
+	}
+	return lines, nil
+}
+
 // handleEmpty detects when FileDiff was an empty diff and will not have any hunks
 // that follow. It updates fd fields from the parsed extended headers.
 func handleEmpty(fd *FileDiff) (wasEmpty bool) {
@@ -603,6 +848,25 @@ var (
 	// ErrBadOnlyInMessage is when a file have a malformed `only in` message
 	// Should be in format `Only in {source}: {filename}`
 	ErrBadOnlyInMessage = errors.New("bad 'only in' message")
+
+	// ErrLineTooLong is when a line is longer than ParseOptions.MaxLineBytes.
+	ErrLineTooLong = errors.New("line too long")
+
+	// ErrHunkTooLarge is when a hunk body is larger than
+	// ParseOptions.MaxHunkBytes.
+	ErrHunkTooLarge = errors.New("hunk too large")
+
+	// ErrTooManyFiles is when a multi-file diff has more files than
+	// ParseOptions.MaxFiles.
+	ErrTooManyFiles = errors.New("too many files")
+
+	// ErrTooManyHunks is when a file diff has more hunks than
+	// ParseOptions.MaxHunksPerFile.
+	ErrTooManyHunks = errors.New("too many hunks")
+
+	// ErrInputTooLarge is when the input is longer than
+	// ParseOptions.MaxTotalBytes.
+	ErrInputTooLarge = errors.New("input too large")
 )
 
 // ParseHunks parses hunks from a unified diff. The diff must consist
@@ -622,6 +886,16 @@ func ParseHunksOptions(diff []byte, opts ParseOptions) ([]*Hunk, error) {
 	return hunks, nil
 }
 
+// ParseHunksContext parses hunks from a unified diff with the given options,
+// stopping with ctx's error (in a ParseError) if ctx is done.
+func ParseHunksContext(ctx context.Context, diff []byte, opts ParseOptions) ([]*Hunk, error) {
+	hunks, err := NewHunksReaderContext(ctx, bytes.NewReader(diff), opts).ReadAllHunks()
+	if err != nil {
+		return nil, err
+	}
+	return hunks, nil
+}
+
 // NewHunksReader returns a new HunksReader that reads unified diff hunks
 // from r.
 func NewHunksReader(r io.Reader) *HunksReader {
@@ -631,7 +905,14 @@ func NewHunksReader(r io.Reader) *HunksReader {
 // NewHunksReaderOptions returns a new HunksReader that reads unified diff hunks
 // from r with the given options.
 func NewHunksReaderOptions(r io.Reader, opts ParseOptions) *HunksReader {
-	return &HunksReader{reader: newLineReaderOptions(r, opts)}
+	return &HunksReader{reader: newLineReaderOptions(r, opts), opts: opts}
+}
+
+// NewHunksReaderContext returns a new HunksReader that reads unified diff
+// hunks from r with the given options. Reading stops with ctx's error (in a
+// ParseError) once ctx is done.
+func NewHunksReaderContext(ctx context.Context, r io.Reader, opts ParseOptions) *HunksReader {
+	return &HunksReader{reader: newLineReaderContext(ctx, r, opts), opts: opts}
 }
 
 // A HunksReader reads hunks from a unified diff.
@@ -640,6 +921,15 @@ type HunksReader struct {
 	offset int64
 	hunk   *Hunk
 	reader *lineReader
+	opts   ParseOptions
+
+	// hunks is the number of hunks read so far (see
+	// ParseOptions.MaxHunksPerFile).
+	hunks int
+
+	// buf is the unused capacity of the buffer the last hunk's body was
+	// read into, which the next hunk's body is read into in turn.
+	buf []byte
 
 	nextHunkHeaderLine []byte
 }
@@ -647,8 +937,35 @@ type HunksReader struct {
 // ReadHunk reads one hunk from r. If there are no more hunks, it
 // returns error io.EOF.
 func (r *HunksReader) ReadHunk() (*Hunk, error) {
+	hunk, err := r.readHunk(nil)
+	if hunk != nil {
+		// Hunk bodies share a buffer, so that reading many small hunks
+		// does not take many small allocations. Limit the body's
+		// capacity so that appending to it never overwrites the next.
+		body := hunk.Body
+		hunk.Body = body[:len(body):len(body)]
+		if len(body) == 0 {
+			hunk.Body = nil
+		}
+		r.buf = body[len(body):]
+	}
+	return hunk, err
+}
+
+// readHunk reads one hunk. If h is not nil, it calls h for the hunk's
+// header and each of its body lines as they are read, instead of building
+// the hunk's Body; h's errors are returned in a handlerError.
+func (r *HunksReader) readHunk(h Handler) (*Hunk, error) {
+	if h != nil {
+		// No line is kept once h has seen it, so the lines need not be
+		// kept apart in the arena.
+		r.reader.arena.reuse = true
+		defer func() { r.reader.arena.reuse = false }()
+	}
 	r.hunk = nil
 	lastLineFromOrig := true
+	var bodyLines int32
+	var size int
 	var line []byte
 	var err error
 	for {
@@ -677,25 +994,27 @@ func (r *HunksReader) ReadHunk() (*Hunk, error) {
 				return nil, &ParseError{r.line, r.offset, ErrNoHunkHeader}
 			}
 
+			r.hunks++
+			if max := r.opts.MaxHunksPerFile; max > 0 && r.hunks > max {
+				return nil, &ParseError{r.line, r.offset, ErrTooManyHunks}
+			}
+
 			// Parse hunk header.
 			r.hunk = &Hunk{}
-			items := []interface{}{
-				&r.hunk.OrigStartLine, &r.hunk.OrigLines,
-				&r.hunk.NewStartLine, &r.hunk.NewLines,
+			if h == nil {
+				if r.buf == nil {
+					r.buf = make([]byte, 0, 1024)
+				}
+				r.hunk.Body = r.buf
 			}
-			header, section, err := normalizeHeader(string(line))
-			if err != nil {
+			if err := parseHunkHeader(line, r.hunk); err != nil {
 				return nil, &ParseError{r.line, r.offset, err}
 			}
-			n, err := fmt.Sscanf(header, hunkHeader, items...)
-			if err != nil {
-				return nil, err
-			}
-			if n < len(items) {
-				return nil, &ParseError{r.line, r.offset, &ErrBadHunkHeader{header: string(line)}}
+			if h != nil {
+				if err := h.HunkHeader(r.hunk); err != nil {
+					return nil, handlerError{err}
+				}
 			}
-
-			r.hunk.Section = section
 		} else {
 			// Read hunk body line.
 
@@ -736,7 +1055,11 @@ func (r *HunksReader) ReadHunk() (*Hunk, error) {
 				return r.hunk, &ParseError{r.line, r.offset, &ErrBadHunkLine{Line: line}}
 			}
 			if bytes.Equal(bytes.TrimSuffix(line, []byte("\r")), []byte(noNewlineMessage)) {
-				if lastLineFromOrig {
+				if h != nil {
+					if err := h.BodyLine([]byte(noNewlineMessage)); err != nil {
+						return nil, handlerError{err}
+					}
+				} else if lastLineFromOrig {
 					// Retain the newline in the body (otherwise the
 					// diff line would be like "-a+b", where "+b" is
 					// the the next line of the new file, which is not
@@ -756,6 +1079,24 @@ func (r *HunksReader) ReadHunk() (*Hunk, error) {
 				lastLineFromOrig = line[0] == '-'
 			}
 
+			if max := r.opts.MaxHunkBytes; max > 0 && size+len(line)+1 > max {
+				return r.hunk, &ParseError{r.line, r.offset, ErrHunkTooLarge}
+			}
+			size += len(line) + 1
+			if h != nil {
+				if err := h.BodyLine(line); err != nil {
+					return nil, handlerError{err}
+				}
+				continue
+			}
+			for _, span := range r.reader.lineSpans {
+				span.Offset += int32(len(r.hunk.Body))
+				r.hunk.ColorSpans = append(r.hunk.ColorSpans, span)
+			}
+			if r.reader.lineCR {
+				r.hunk.CRLFLines = append(r.hunk.CRLFLines, bodyLines)
+			}
+			bodyLines++
 			r.hunk.Body = append(r.hunk.Body, line...)
 			r.hunk.Body = append(r.hunk.Body, '\n')
 		}
@@ -780,40 +1121,60 @@ func linePrefix(c byte) bool {
 	return false
 }
 
-// normalizeHeader takes a header of the form:
-// "@@ -linestart[,chunksize] +linestart[,chunksize] @@ section"
-// and returns two strings, with the first in the form:
-// "@@ -linestart,chunksize +linestart,chunksize @@".
-// where linestart and chunksize are both integers. The second is the
-// optional section header. chunksize may be omitted from the header
-// if its value is 1. normalizeHeader returns an error if the header
-// is not in the correct format.
-func normalizeHeader(header string) (string, string, error) {
-	header = strings.TrimSuffix(header, "\r")
-	// Split the header into five parts: the first '@@', the two
-	// ranges, the last '@@', and the optional section.
-	pieces := strings.SplitN(header, " ", 5)
-	if len(pieces) < 4 {
-		return "", "", &ErrBadHunkHeader{header: header}
+// parseHunkHeader parses a hunk header line of the form
+//
+//	@@ -linestart[,chunksize] +linestart[,chunksize] @@ section
+//
+// into the line ranges and section of h. chunksize may be omitted from the
+// header if its value is 1, and the section is optional.
+func parseHunkHeader(line []byte, h *Hunk) error {
+	header := bytes.TrimSuffix(line, []byte("\r"))
+	rest, ok := bytes.CutPrefix(header, []byte("@@ -"))
+	if ok {
+		h.OrigStartLine, h.OrigLines, rest, ok = parseHunkRange(rest)
 	}
-
-	if pieces[0] != "@@" {
-		return "", "", &ErrBadHunkHeader{header: header}
+	if ok {
+		rest, ok = bytes.CutPrefix(rest, []byte(" +"))
 	}
-	for i := 1; i < 3; i++ {
-		if !strings.ContainsRune(pieces[i], ',') {
-			pieces[i] = pieces[i] + ",1"
-		}
+	if ok {
+		h.NewStartLine, h.NewLines, rest, ok = parseHunkRange(rest)
+	}
+	if ok {
+		rest, ok = bytes.CutPrefix(rest, []byte(" @@"))
 	}
-	if pieces[3] != "@@" {
-		return "", "", &ErrBadHunkHeader{header: header}
+	if ok && len(rest) > 0 {
+		rest, ok = bytes.CutPrefix(rest, []byte(" "))
 	}
+	if !ok {
+		return &ErrBadHunkHeader{header: string(header)}
+	}
+	h.Section = string(bytes.TrimSpace(rest))
+	return nil
+}
 
-	var section string
-	if len(pieces) == 5 {
-		section = pieces[4]
+// parseHunkRange parses the "linestart[,chunksize]" at the start of b.
+func parseHunkRange(b []byte) (start, lines int32, rest []byte, ok bool) {
+	start, rest, ok = parseInt32(b)
+	if !ok {
+		return 0, 0, nil, false
 	}
-	return strings.Join(pieces, " "), strings.TrimSpace(section), nil
+	if rest, ok = bytes.CutPrefix(rest, []byte(",")); !ok {
+		return start, 1, rest, true
+	}
+	lines, rest, ok = parseInt32(rest)
+	return start, lines, rest, ok
+}
+
+// parseInt32 parses the non-negative decimal number at the start of b.
+func parseInt32(b []byte) (n int32, rest []byte, ok bool) {
+	i := 0
+	for ; i < len(b) && '0' <= b[i] && b[i] <= '9'; i++ {
+		if n > (math.MaxInt32-int32(b[i]-'0'))/10 {
+			return 0, nil, false
+		}
+		n = n*10 + int32(b[i]-'0')
+	}
+	return n, b[i:], i > 0
 }
 
 // ReadAllHunks reads all remaining hunks from r. A successful call
@@ -840,6 +1201,87 @@ func (r *HunksReader) ReadAllHunks() ([]*Hunk, error) {
 	}
 }
 
+// isDirMessage reports whether line is one of the messages that diff -r
+// prints instead of a unified diff (see parseDirMessage). gitDiff is whether
+// a "diff --git" line was read for the current file (after any preamble):
+// "Binary files X and Y differ" is only a message of its own when it is not
+// part of a git diff's extended headers.
+func isDirMessage(line []byte, gitDiff bool) bool {
+	kind, _, _, ok := parseDirMessage(line)
+	if !ok {
+		return false
+	}
+	if kind == KindBinaryFilesDiffer && gitDiff {
+		return false
+	}
+	return true
+}
+
+// parseDirMessage parses the messages that diff -r prints in place of a
+// unified diff:
+//
+//	Only in {dir}: {name}
+//	Common subdirectories: {orig} and {new}
+//	Files {orig} and {new} differ
+//	Binary files {orig} and {new} differ
+//
+// Paths are always slash-separated, regardless of the host OS. For "Only in"
+// messages, origName is the joined path and newName is empty.
+func parseDirMessage(line []byte) (kind FileDiffKind, origName, newName string, ok bool) {
+	if isOnlyIn, source, filename := parseOnlyInMessage(line); isOnlyIn {
+		return KindOnlyIn, path.Join(string(source), string(filename)), "", true
+	}
+	if !bytes.HasPrefix(line, []byte(commonSubdirectoriesPrefix)) && !bytes.HasPrefix(line, []byte(filesPrefix)) && !bytes.HasPrefix(line, []byte(binaryFilesPrefix)) {
+		// Avoid converting every extended header line to a string.
+		return KindUnified, "", "", false
+	}
+
+	text := strings.TrimSuffix(string(line), "\r")
+	switch {
+	case strings.HasPrefix(text, commonSubdirectoriesPrefix):
+		kind, text = KindCommonSubdirectories, text[len(commonSubdirectoriesPrefix):]
+	case strings.HasPrefix(text, filesPrefix) && strings.HasSuffix(text, differSuffix):
+		kind, text = KindFilesDiffer, text[len(filesPrefix):len(text)-len(differSuffix)]
+	case strings.HasPrefix(text, binaryFilesPrefix) && strings.HasSuffix(text, differSuffix):
+		kind, text = KindBinaryFilesDiffer, text[len(binaryFilesPrefix):len(text)-len(differSuffix)]
+	default:
+		return KindUnified, "", "", false
+	}
+
+	origName, newName, ok = splitPathPair(text)
+	if !ok {
+		return KindUnified, "", "", false
+	}
+	return kind, origName, newName, true
+}
+
+// splitPathPair splits text of the form "{orig} and {new}". Because either
+// path may itself contain " and ", it prefers the split whose two paths have
+// the same base name (which is what diff -r produces), falling back to the
+// first occurrence.
+func splitPathPair(text string) (origName, newName string, ok bool) {
+	const sep = " and "
+	first := -1
+	for i := 0; i+len(sep) <= len(text); i++ {
+		if !strings.HasPrefix(text[i:], sep) {
+			continue
+		}
+		if i == 0 || i+len(sep) == len(text) {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		if path.Base(text[:i]) == path.Base(text[i+len(sep):]) {
+			return text[:i], text[i+len(sep):], true
+		}
+	}
+	if first < 0 {
+		return "", "", false
+	}
+	return text[:first], text[first+len(sep):], true
+}
+
 // parseOnlyInMessage checks if line is a "Only in {source}: {filename}" and returns source and filename
 func parseOnlyInMessage(line []byte) (bool, []byte, []byte) {
 	if !bytes.HasPrefix(line, onlyInMessagePrefix) {
@@ -865,6 +1307,11 @@ func (e *ParseError) Error() string {
 	return fmt.Sprintf("line %d, char %d: %s", e.Line, e.Offset, e.Err)
 }
 
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
 // ErrNoHunkHeader indicates that a unified diff hunk header was
 // expected but not found during parsing.
 var ErrNoHunkHeader = errors.New("no hunk header")
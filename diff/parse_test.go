@@ -1,6 +1,9 @@
 package diff
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -91,3 +94,89 @@ func TestParseDiffGitArgs_Unsuccessful(t *testing.T) {
 		}
 	}
 }
+
+func TestSplitPathPair(t *testing.T) {
+	tests := []struct {
+		input, orig, new string
+	}{
+		{input: `a/x and b/x`, orig: "a/x", new: "b/x"},
+		{input: `a/rock and roll and b/rock and roll`, orig: "a/rock and roll", new: "b/rock and roll"},
+		{input: `a/x and b/y`, orig: "a/x", new: "b/y"},
+		{input: `a/x and y and b/z`, orig: "a/x", new: "y and b/z"},
+	}
+	for _, tc := range tests {
+		orig, new, ok := splitPathPair(tc.input)
+		if !ok {
+			t.Errorf("splitPathPair(`%s`): expected success", tc.input)
+		} else if orig != tc.orig || new != tc.new {
+			t.Errorf("splitPathPair(`%s`): expected `%s` and `%s`, got `%s` and `%s`", tc.input, tc.orig, tc.new, orig, new)
+		}
+	}
+
+	for _, input := range []string{``, `a/x`, ` and b/x`, `a/x and `} {
+		if orig, new, ok := splitPathPair(input); ok {
+			t.Errorf("splitPathPair(`%s`): expected unsuccessful; got `%s` and `%s`", input, orig, new)
+		}
+	}
+}
+
+// benchmarkFiles are the real-world fixtures that the parser benchmarks are
+// made of.
+var benchmarkFiles = []string{
+	"sample_multi_file.diff",
+	"sample_multi_file_rename.diff",
+	"sample_multi_file_new.diff",
+	"sample_multi_file_minuses_pluses.diff",
+}
+
+// benchmarkDiff returns a large multi-file diff made of real-world
+// fixtures, including one with a very long line.
+func benchmarkDiff(b *testing.B) []byte {
+	return repeatFixtures(b, append(benchmarkFiles[:len(benchmarkFiles):len(benchmarkFiles)], "long_line_multi.diff"), 20)
+}
+
+// repeatFixtures returns the fixtures with the given names, concatenated
+// and repeated n times.
+func repeatFixtures(b *testing.B, names []string, n int) []byte {
+	var diff []byte
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			b.Fatal(err)
+		}
+		diff = append(diff, data...)
+	}
+	return bytes.Repeat(diff, n)
+}
+
+func BenchmarkParseMultiFileDiff(b *testing.B) {
+	benchmarkParseMultiFileDiff(b, benchmarkDiff(b))
+}
+
+// BenchmarkParseMultiFileDiff_ManyFiles parses a diff of about the same
+// size as BenchmarkParseMultiFileDiff's, made of many small files instead.
+func BenchmarkParseMultiFileDiff_ManyFiles(b *testing.B) {
+	benchmarkParseMultiFileDiff(b, repeatFixtures(b, benchmarkFiles, 2000))
+}
+
+func benchmarkParseMultiFileDiff(b *testing.B, diff []byte) {
+	b.SetBytes(int64(len(diff)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseMultiFileDiff(diff); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseHunkHeader(b *testing.B) {
+	line := []byte("@@ -1604,7 +1604,11 @@ func (r *HunksReader) ReadHunk() (*Hunk, error) {")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var h Hunk
+		if err := parseHunkHeader(line, &h); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
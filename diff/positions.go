@@ -0,0 +1,129 @@
+package diff
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+)
+
+// A positionLine is a line of a file's diff, with its GitHub-style
+// position.
+type positionLine struct {
+	position int32
+	// op is ' ', '-' or '+', or 0 for a hunk header or a "\ No newline at
+	// end of file" line.
+	op byte
+	// orig and new are the 1-indexed lines of the files the line is on.
+	// For a '+' line orig is the original file's next line, and for a '-'
+	// line new is the new file's next line.
+	orig, new int32
+}
+
+// positionLines returns the lines of d's hunks. The position of a line is
+// the number of lines it is below the first hunk header (so the first body
+// line is at position 1), counting later hunk headers and "\ No newline at
+// end of file" lines, as in GitHub's API.
+func (d *FileDiff) positionLines() []positionLine {
+	var lines []positionLine
+	var pos int32
+	for i, h := range d.Hunks {
+		if i > 0 {
+			pos++
+			lines = append(lines, positionLine{position: pos})
+		}
+		hls, err := bodyLines(h)
+		if err != nil {
+			return lines
+		}
+		orig, new := hunkBegin(h.OrigStartLine, h.OrigLines)+1, hunkBegin(h.NewStartLine, h.NewLines)+1
+		for _, l := range hls {
+			pos++
+			lines = append(lines, positionLine{position: pos, op: l.op, orig: orig, new: new})
+			if l.op != '+' {
+				orig++
+			}
+			if l.op != '-' {
+				new++
+			}
+			if len(l.text) == 0 || l.text[len(l.text)-1] != '\n' {
+				pos++
+				lines = append(lines, positionLine{position: pos})
+			}
+		}
+	}
+	return lines
+}
+
+// PositionToLine returns the side and 1-indexed line of the file that the
+// GitHub-style position (see Hunk.StartPosition) in d is on. A context line
+// is on both sides; it is reported on SideNew, as GitHub does. ok is false
+// if the position is not a line of a file (e.g., it is a hunk header).
+func (d *FileDiff) PositionToLine(position int32) (side Side, line int32, ok bool) {
+	for _, l := range d.positionLines() {
+		if l.position != position {
+			continue
+		}
+		switch l.op {
+		case '-':
+			return SideOrig, l.orig, true
+		case ' ', '+':
+			return SideNew, l.new, true
+		}
+		break
+	}
+	return 0, 0, false
+}
+
+// LineToPosition returns the GitHub-style position in d of the 1-indexed
+// line of the file on the given side. ok is false if the line is not in
+// any hunk.
+func (d *FileDiff) LineToPosition(side Side, line int32) (position int32, ok bool) {
+	for _, l := range d.positionLines() {
+		if onSide(l, side, line) {
+			return l.position, true
+		}
+	}
+	return 0, false
+}
+
+// onSide reports whether l is the given line of the file on side.
+func onSide(l positionLine, side Side, line int32) bool {
+	if side == SideOrig {
+		return (l.op == ' ' || l.op == '-') && l.orig == line
+	}
+	return (l.op == ' ' || l.op == '+') && l.new == line
+}
+
+// A GitLabPosition identifies a line of a diff as GitLab's API does.
+type GitLabPosition struct {
+	// OldLine and NewLine are the 1-indexed lines of the original and
+	// new files (the old_line and new_line of GitLab's API). OldLine is
+	// 0 for an added line and NewLine for a removed line.
+	OldLine, NewLine int32
+	// LineCode is GitLab's line_code: the SHA-1 of the file's path and
+	// the line's original and new line numbers (for an added or removed
+	// line, the other file's next line).
+	LineCode string
+}
+
+// GitLabPosition returns the GitLab position of the 1-indexed line of the
+// file on the given side. ok is false if the line is not in any hunk.
+func (d *FileDiff) GitLabPosition(side Side, line int32) (pos GitLabPosition, ok bool) {
+	for _, l := range d.positionLines() {
+		if !onSide(l, side, line) {
+			continue
+		}
+		switch l.op {
+		case ' ':
+			pos.OldLine, pos.NewLine = l.orig, l.new
+		case '-':
+			pos.OldLine = l.orig
+		case '+':
+			pos.NewLine = l.new
+		}
+		sum := sha1.Sum([]byte(fileDiffPath(d)))
+		pos.LineCode = hex.EncodeToString(sum[:]) + "_" + strconv.Itoa(int(l.orig)) + "_" + strconv.Itoa(int(l.new))
+		return pos, true
+	}
+	return GitLabPosition{}, false
+}
@@ -0,0 +1,92 @@
+package diff
+
+import "testing"
+
+func TestFileDiff_PositionToLine(t *testing.T) {
+	fd, err := ParseFileDiff([]byte("--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n@@ -10,2 +10,3 @@\n j\n+x\n k\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		position int32
+		side     Side
+		line     int32
+		ok       bool
+	}{
+		{1, SideNew, 1, true},
+		{2, SideOrig, 2, true},
+		{3, SideNew, 2, true},
+		{4, SideNew, 3, true},
+		{5, 0, 0, false},
+		{6, SideNew, 10, true},
+		{7, SideNew, 11, true},
+		{8, SideNew, 12, true},
+		{9, 0, 0, false},
+	}
+	for _, test := range tests {
+		side, line, ok := fd.PositionToLine(test.position)
+		if side != test.side || line != test.line || ok != test.ok {
+			t.Errorf("PositionToLine(%d): got %v, %d, %v", test.position, side, line, ok)
+		}
+		if !ok {
+			continue
+		}
+		if pos, ok := fd.LineToPosition(side, line); pos != test.position || !ok {
+			t.Errorf("LineToPosition(%v, %d): got %d, %v, want %d", side, line, pos, ok, test.position)
+		}
+	}
+
+	if pos, ok := fd.LineToPosition(SideOrig, 11); pos != 8 || !ok {
+		t.Errorf("LineToPosition(orig, 11): got %d, %v, want 8", pos, ok)
+	}
+	if _, ok := fd.LineToPosition(SideOrig, 5); ok {
+		t.Error("LineToPosition(orig, 5): got ok for a line outside the hunks")
+	}
+	for _, h := range fd.Hunks {
+		side, line, _ := fd.PositionToLine(h.StartPosition)
+		if pos, _ := fd.LineToPosition(side, line); pos != h.StartPosition {
+			t.Errorf("got position %d for the first line of the hunk at %d", pos, h.StartPosition)
+		}
+	}
+}
+
+func TestFileDiff_PositionToLine_noNewline(t *testing.T) {
+	fd, err := ParseFileDiff([]byte("--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := fd.PositionToLine(3); ok {
+		t.Error("PositionToLine(3): got ok for a \"No newline\" line")
+	}
+	if side, line, ok := fd.PositionToLine(4); side != SideNew || line != 2 || !ok {
+		t.Errorf("PositionToLine(4): got %v, %d, %v", side, line, ok)
+	}
+}
+
+func TestFileDiff_GitLabPosition(t *testing.T) {
+	fd, err := ParseFileDiff([]byte("--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const sha = "4a0a19218e082a343a1b17e5333409af9d98f0f5"
+	tests := []struct {
+		side Side
+		line int32
+		want GitLabPosition
+	}{
+		{SideOrig, 1, GitLabPosition{OldLine: 1, NewLine: 1, LineCode: sha + "_1_1"}},
+		{SideOrig, 2, GitLabPosition{OldLine: 2, LineCode: sha + "_2_2"}},
+		{SideNew, 2, GitLabPosition{NewLine: 2, LineCode: sha + "_3_2"}},
+		{SideNew, 3, GitLabPosition{OldLine: 3, NewLine: 3, LineCode: sha + "_3_3"}},
+	}
+	for _, test := range tests {
+		got, ok := fd.GitLabPosition(test.side, test.line)
+		if !ok || got != test.want {
+			t.Errorf("GitLabPosition(%v, %d): got %+v, %v, want %+v", test.side, test.line, got, ok, test.want)
+		}
+	}
+	if _, ok := fd.GitLabPosition(SideNew, 4); ok {
+		t.Error("GitLabPosition(new, 4): got ok for a line outside the hunks")
+	}
+}
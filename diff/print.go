@@ -2,17 +2,35 @@ package diff
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"path/filepath"
+	"path"
 	"time"
 )
 
+// PrintOptions specifies options for printing diffs.
+type PrintOptions struct {
+	// LineEndings says how the line endings of hunk body lines are written
+	// (see ConvertLineEndings). The zero value writes hunk bodies as they
+	// are stored.
+	LineEndings LineEndingMode
+}
+
 // PrintMultiFileDiff prints a multi-file diff in unified diff format.
 func PrintMultiFileDiff(ds []*FileDiff) ([]byte, error) {
+	return PrintMultiFileDiffContext(context.Background(), ds)
+}
+
+// PrintMultiFileDiffContext is like PrintMultiFileDiff, but returns ctx's
+// error once ctx is done. It is checked between files and hunks.
+func PrintMultiFileDiffContext(ctx context.Context, ds []*FileDiff) ([]byte, error) {
 	var buf bytes.Buffer
 	for _, d := range ds {
-		diff, err := PrintFileDiff(d)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		diff, err := PrintFileDiffContext(ctx, d)
 		if err != nil {
 			return nil, err
 		}
@@ -23,23 +41,47 @@ func PrintMultiFileDiff(ds []*FileDiff) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// PrintMultiFileDiffOptions prints a multi-file diff in unified diff format
+// with the given options.
+func PrintMultiFileDiffOptions(ds []*FileDiff, opts PrintOptions) ([]byte, error) {
+	converted := make([]*FileDiff, len(ds))
+	for i, d := range ds {
+		converted[i] = ConvertLineEndings(d, opts.LineEndings)
+	}
+	return PrintMultiFileDiff(converted)
+}
+
 // PrintFileDiff prints a FileDiff in unified diff format.
 //
 // TODO(sqs): handle escaping whitespace/etc. chars in filenames
 func PrintFileDiff(d *FileDiff) ([]byte, error) {
+	return PrintFileDiffContext(context.Background(), d)
+}
+
+// PrintFileDiffContext is like PrintFileDiff, but returns ctx's error once
+// ctx is done. It is checked between hunks.
+func PrintFileDiffContext(ctx context.Context, d *FileDiff) ([]byte, error) {
 	var buf bytes.Buffer
 
+	for _, line := range d.Preamble {
+		if _, err := fmt.Fprintln(&buf, line); err != nil {
+			return nil, err
+		}
+	}
 	for _, xheader := range d.Extended {
 		if _, err := fmt.Fprintln(&buf, xheader); err != nil {
 			return nil, err
 		}
 	}
 
-	// FileDiff is added/deleted file
+	// FileDiff is a message from a recursive diff (e.g., added/deleted file)
 	// No further hunks printing needed
-	if d.NewName == "" {
-		_, err := fmt.Fprintf(&buf, onlyInMessage, filepath.Dir(d.OrigName), filepath.Base(d.OrigName))
-		if err != nil {
+	kind := d.Kind
+	if kind == KindUnified && d.NewName == "" {
+		kind = KindOnlyIn
+	}
+	if kind != KindUnified {
+		if err := printDirMessage(&buf, kind, d.OrigName, d.NewName); err != nil {
 			return nil, err
 		}
 		return buf.Bytes(), nil
@@ -49,14 +91,14 @@ func PrintFileDiff(d *FileDiff) ([]byte, error) {
 		return buf.Bytes(), nil
 	}
 
-	if err := printFileHeader(&buf, "--- ", d.OrigName, d.OrigTime); err != nil {
+	if err := printFileHeader(&buf, "--- ", d.OrigName, d.OrigTime, d.OrigTimeLayout, d.OrigLabel); err != nil {
 		return nil, err
 	}
-	if err := printFileHeader(&buf, "+++ ", d.NewName, d.NewTime); err != nil {
+	if err := printFileHeader(&buf, "+++ ", d.NewName, d.NewTime, d.NewTimeLayout, d.NewLabel); err != nil {
 		return nil, err
 	}
 
-	ph, err := PrintHunks(d.Hunks)
+	ph, err := PrintHunksContext(ctx, d.Hunks)
 	if err != nil {
 		return nil, err
 	}
@@ -67,12 +109,38 @@ func PrintFileDiff(d *FileDiff) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func printFileHeader(w io.Writer, prefix string, filename string, timestamp *time.Time) error {
+// printDirMessage prints one of the messages diff -r prints instead of a
+// unified diff. Paths are treated as slash-separated on all platforms.
+func printDirMessage(w io.Writer, kind FileDiffKind, origName, newName string) error {
+	var err error
+	switch kind {
+	case KindOnlyIn:
+		_, err = fmt.Fprintf(w, onlyInMessage, path.Dir(origName), path.Base(origName))
+	case KindCommonSubdirectories:
+		_, err = fmt.Fprintf(w, "%s%s and %s\n", commonSubdirectoriesPrefix, origName, newName)
+	case KindFilesDiffer:
+		_, err = fmt.Fprintf(w, "%s%s and %s%s\n", filesPrefix, origName, newName, differSuffix)
+	case KindBinaryFilesDiffer:
+		_, err = fmt.Fprintf(w, "%s%s and %s%s\n", binaryFilesPrefix, origName, newName, differSuffix)
+	default:
+		err = fmt.Errorf("unknown FileDiff kind %d", kind)
+	}
+	return err
+}
+
+func printFileHeader(w io.Writer, prefix string, filename string, timestamp *time.Time, layout, label string) error {
 	if _, err := fmt.Fprint(w, prefix, filename); err != nil {
 		return err
 	}
 	if timestamp != nil {
-		if _, err := fmt.Fprint(w, "\t", timestamp.Format(diffTimeFormatLayout)); err != nil {
+		if layout == "" {
+			layout = diffTimeFormatLayout
+		}
+		if _, err := fmt.Fprint(w, "\t", timestamp.Format(layout)); err != nil {
+			return err
+		}
+	} else if label != "" {
+		if _, err := fmt.Fprint(w, "\t", label); err != nil {
 			return err
 		}
 	}
@@ -82,23 +150,26 @@ func printFileHeader(w io.Writer, prefix string, filename string, timestamp *tim
 	return nil
 }
 
+// PrintFileDiffOptions prints a FileDiff in unified diff format with the
+// given options.
+func PrintFileDiffOptions(d *FileDiff, opts PrintOptions) ([]byte, error) {
+	return PrintFileDiff(ConvertLineEndings(d, opts.LineEndings))
+}
+
 // PrintHunks prints diff hunks in unified diff format.
 func PrintHunks(hunks []*Hunk) ([]byte, error) {
+	return PrintHunksContext(context.Background(), hunks)
+}
+
+// PrintHunksContext is like PrintHunks, but returns ctx's error once ctx is
+// done. It is checked before each hunk.
+func PrintHunksContext(ctx context.Context, hunks []*Hunk) ([]byte, error) {
 	var buf bytes.Buffer
 	for _, hunk := range hunks {
-		_, err := fmt.Fprintf(&buf,
-			"@@ -%d,%d +%d,%d @@", hunk.OrigStartLine, hunk.OrigLines, hunk.NewStartLine, hunk.NewLines,
-		)
-		if err != nil {
+		if err := ctx.Err(); err != nil {
 			return nil, err
 		}
-		if hunk.Section != "" {
-			_, err := fmt.Fprint(&buf, " ", hunk.Section)
-			if err != nil {
-				return nil, err
-			}
-		}
-		if _, err := fmt.Fprintln(&buf); err != nil {
+		if err := printHunkHeader(&buf, hunk.OrigStartLine, hunk.OrigLines, hunk.NewStartLine, hunk.NewLines, hunk.Section); err != nil {
 			return nil, err
 		}
 
@@ -130,6 +201,28 @@ func PrintHunks(hunks []*Hunk) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// PrintHunksOptions prints diff hunks in unified diff format with the given
+// options. LineEndingsNormalize uses the most common line ending of hunks.
+func PrintHunksOptions(hunks []*Hunk, opts PrintOptions) ([]byte, error) {
+	return PrintHunks(ConvertLineEndings(&FileDiff{Hunks: hunks}, opts.LineEndings).Hunks)
+}
+
+func printHunkHeader(w io.Writer, origStartLine, origLines, newStartLine, newLines int32, section string) error {
+	_, err := fmt.Fprintf(w, hunkHeader, origStartLine, origLines, newStartLine, newLines)
+	if err != nil {
+		return err
+	}
+	if section != "" {
+		if _, err := fmt.Fprint(w, " ", section); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintln(w); err != nil {
+		return err
+	}
+	return nil
+}
+
 func printNoNewlineMessage(w io.Writer) error {
 	if _, err := w.Write([]byte(noNewlineMessage)); err != nil {
 		return err
@@ -3,6 +3,7 @@ package diff
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"io"
 )
@@ -14,29 +15,90 @@ func newLineReader(r io.Reader) *lineReader {
 }
 
 func newLineReaderOptions(r io.Reader, opts ParseOptions) *lineReader {
+	if opts.MaxTotalBytes > 0 {
+		r = &maxBytesReader{reader: r, remaining: opts.MaxTotalBytes}
+	}
+	if opts.Encoding != EncodingNone {
+		r = newDecodingReader(r, opts.Encoding)
+	}
 	return &lineReader{
-		reader: bufio.NewReader(r),
-		keepCR: opts.KeepCR,
+		reader:         bufio.NewReader(r),
+		maxLineBytes:   opts.MaxLineBytes,
+		keepCR:         opts.KeepCR,
+		stripANSI:      opts.StripANSI || opts.KeepColorSpans,
+		keepColorSpans: opts.KeepColorSpans,
 	}
 }
 
+func newLineReaderContext(ctx context.Context, r io.Reader, opts ParseOptions) *lineReader {
+	l := newLineReaderOptions(r, opts)
+	l.ctx = ctx
+	return l
+}
+
 // lineReader is a wrapper around a bufio.Reader that caches the next line to
 // provide lookahead functionality for the next two lines.
 type lineReader struct {
 	reader *bufio.Reader
 
-	cachedNextLine    []byte
-	cachedNextLineErr error
+	// ctx, if set, is checked before every line is returned.
+	ctx context.Context
+	// line and offset count the lines and bytes (excluding newlines)
+	// returned so far, for the position of cancellation errors.
+	line   int
+	offset int64
 
-	keepCR bool
+	cachedNextLine      []byte
+	cachedNextLineSpans []ColorSpan
+	cachedNextLineCR    bool
+	cachedNextLineErr   error
+
+	// lineSpans are the color spans removed from the line most recently
+	// returned by readLine (only if keepColorSpans is set).
+	lineSpans []ColorSpan
+	// lineCR is whether a carriage return was dropped from the end of the
+	// line most recently returned by readLine (only if keepCR is unset).
+	lineCR bool
+
+	keepCR         bool
+	stripANSI      bool
+	keepColorSpans bool
+	maxLineBytes   int
+
+	arena lineArena
 }
 
 func (l *lineReader) ensureCachedNextLine() {
 	if l.cachedNextLine == nil && l.cachedNextLineErr == nil {
-		l.cachedNextLine, l.cachedNextLineErr = readLine(l.reader, l.keepCR)
+		l.cachedNextLine, l.cachedNextLineSpans, l.cachedNextLineCR, l.cachedNextLineErr = l.readRawLine()
 	}
 }
 
+// readRawLine reads the next line from the underlying reader, removing ANSI
+// SGR escape sequences if requested. It reports whether a trailing carriage
+// return was dropped.
+func (l *lineReader) readRawLine() ([]byte, []ColorSpan, bool, error) {
+	line, err := readLineArena(l.reader, true, l.maxLineBytes, &l.arena)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	var spans []ColorSpan
+	if l.stripANSI {
+		var spansp *[]ColorSpan
+		if l.keepColorSpans {
+			spansp = &spans
+		}
+		// A carriage return may be followed by an escape sequence, so
+		// strip those first.
+		line = stripSGR(line, spansp)
+	}
+	if l.keepCR {
+		return line, spans, false, nil
+	}
+	trimmed := dropCR(line)
+	return trimmed, spans, len(trimmed) < len(line), nil
+}
+
 // readLine returns the next unconsumed line and advances the internal cache of
 // the lineReader.
 func (l *lineReader) readLine() ([]byte, error) {
@@ -46,9 +108,21 @@ func (l *lineReader) readLine() ([]byte, error) {
 		return nil, l.cachedNextLineErr
 	}
 
+	if l.ctx != nil {
+		select {
+		case <-l.ctx.Done():
+			return nil, &ParseError{l.line, l.offset, l.ctx.Err()}
+		default:
+		}
+	}
+
 	next := l.cachedNextLine
+	l.line++
+	l.offset += int64(len(next))
+	l.lineSpans = l.cachedNextLineSpans
+	l.lineCR = l.cachedNextLineCR
 
-	l.cachedNextLine, l.cachedNextLineErr = readLine(l.reader, l.keepCR)
+	l.cachedNextLine, l.cachedNextLineSpans, l.cachedNextLineCR, l.cachedNextLineErr = l.readRawLine()
 
 	return next, nil
 }
@@ -72,10 +146,41 @@ func (l *lineReader) nextLineStartsWith(prefix string) (bool, error) {
 func (l *lineReader) nextNextLineStartsWith(prefix string) (bool, error) {
 	l.ensureCachedNextLine()
 
+	if l.stripANSI {
+		next, err := l.peekStripped(len(prefix))
+		return l.lineHasPrefix(next, prefix, err)
+	}
+
 	next, err := l.reader.Peek(len(prefix))
 	return l.lineHasPrefix(next, prefix, err)
 }
 
+// peekStripped returns at least n bytes of the unread input with ANSI SGR
+// escape sequences removed, without consuming it. Escape sequences may cut
+// across any fixed-size window, so it peeks up to the end of the line (or
+// as much of it as fits in the buffer).
+func (l *lineReader) peekStripped(n int) ([]byte, error) {
+	size := n
+	for {
+		raw, err := l.reader.Peek(size)
+		i := bytes.IndexByte(raw, '\n')
+		if i >= 0 {
+			raw = raw[:i]
+		}
+		if i >= 0 || err != nil {
+			next := stripSGR(raw, nil)
+			if len(next) >= n {
+				return next[:n], nil
+			}
+			if err == nil {
+				err = io.EOF // the line ended before n bytes
+			}
+			return next, err
+		}
+		size *= 2
+	}
+}
+
 // lineHasPrefix checks whether the given line has the given prefix with
 // bytes.HasPrefix.
 //
@@ -99,12 +204,46 @@ func (l *lineReader) lineHasPrefix(line []byte, prefix string, readErr error) (b
 // io.EOF error when there is nothing left to read (at the start of the function call). It
 // will return any other errors it receives from the underlying call to ReadBytes.
 func readLine(r *bufio.Reader, keepCR bool) ([]byte, error) {
-	line, err := r.ReadBytes('\n')
-	if err == io.EOF && len(line) == 0 {
-		return nil, io.EOF
-	}
-	if err != nil && err != io.EOF {
-		return nil, err
+	return readLineLimit(r, keepCR, 0)
+}
+
+// readLineLimit is like readLine, but if maxLineBytes > 0, it returns
+// ErrLineTooLong as soon as the line (excluding its terminating newline) is
+// longer than maxLineBytes, without reading the rest of it.
+func readLineLimit(r *bufio.Reader, keepCR bool, maxLineBytes int) ([]byte, error) {
+	return readLineArena(r, keepCR, maxLineBytes, nil)
+}
+
+// readLineArena is like readLineLimit, but copies lines that fit in the
+// bufio.Reader's buffer into arena (if not nil).
+func readLineArena(r *bufio.Reader, keepCR bool, maxLineBytes int, arena *lineArena) ([]byte, error) {
+	var line []byte
+	for first := true; ; first = false {
+		frag, err := r.ReadSlice('\n')
+		if first && err != bufio.ErrBufferFull {
+			line = arena.copy(frag)
+		} else {
+			line = append(line, frag...)
+		}
+		if maxLineBytes > 0 {
+			n := len(line)
+			if err == nil {
+				n-- // the newline
+			}
+			if n > maxLineBytes {
+				return nil, ErrLineTooLong
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(line) == 0 {
+			return nil, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		break
 	}
 	if line[len(line)-1] == '\n' {
 		line = line[:len(line)-1]
@@ -115,6 +254,116 @@ func readLine(r *bufio.Reader, keepCR bool) ([]byte, error) {
 	return line, nil
 }
 
+// A lineArena hands out copies of lines carved from larger blocks, so that
+// reading a line does not take an allocation of its own. Each copy has its
+// capacity limited to its length, so appending to it never overwrites
+// another line.
+type lineArena struct {
+	block []byte
+
+	// reuse is whether copies are made into bufs in turn instead, for a
+	// reader whose lines are only used until the next but one is read
+	// (the lineReader reads one line ahead). next is the buffer to use.
+	reuse bool
+	bufs  [2][]byte
+	next  int
+}
+
+const lineArenaBlockSize = 16 << 10
+
+// copy returns a copy of b. A nil *lineArena allocates each copy.
+func (a *lineArena) copy(b []byte) []byte {
+	if a != nil && a.reuse {
+		buf := append(a.bufs[a.next][:0], b...)
+		a.bufs[a.next] = buf
+		a.next ^= 1
+		return buf[:len(buf):len(buf)]
+	}
+	if a == nil || len(b) > lineArenaBlockSize/4 {
+		return append([]byte(nil), b...)
+	}
+	if len(b) > cap(a.block)-len(a.block) {
+		a.block = make([]byte, 0, lineArenaBlockSize)
+	}
+	n := len(a.block)
+	a.block = append(a.block, b...)
+	return a.block[n:len(a.block):len(a.block)]
+}
+
+// maxBytesReader is an io.Reader that returns ErrInputTooLarge once more
+// than remaining bytes have been read from the underlying reader.
+type maxBytesReader struct {
+	reader    io.Reader
+	remaining int64
+	err       error
+}
+
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	// Read one byte more than allowed, to tell whether the input ends
+	// exactly at the limit.
+	if int64(len(p)) > m.remaining+1 {
+		p = p[:m.remaining+1]
+	}
+	n, err := m.reader.Read(p)
+	if int64(n) <= m.remaining {
+		m.remaining -= int64(n)
+		return n, err
+	}
+	n = int(m.remaining)
+	m.remaining = 0
+	m.err = ErrInputTooLarge
+	return n, m.err
+}
+
+// stripSGR removes ANSI SGR escape sequences ("\x1b[...m", as written by
+// git diff --color) from line. If spans is non-nil, the removed sequences
+// are appended to it with their offsets in the stripped line.
+func stripSGR(line []byte, spans *[]ColorSpan) []byte {
+	i := bytes.IndexByte(line, '\x1b')
+	if i < 0 {
+		return line
+	}
+	out := make([]byte, 0, len(line))
+	for i >= 0 {
+		out = append(out, line[:i]...)
+		line = line[i:]
+		n := sgrLen(line)
+		if n == 0 {
+			// Not an SGR sequence; keep the escape character.
+			out = append(out, line[0])
+			line = line[1:]
+		} else {
+			if spans != nil {
+				*spans = append(*spans, ColorSpan{Offset: int32(len(out)), Code: string(line[:n])})
+			}
+			line = line[n:]
+		}
+		i = bytes.IndexByte(line, '\x1b')
+	}
+	return append(out, line...)
+}
+
+// sgrLen returns the length of the SGR escape sequence at the start of b,
+// or 0 if b does not start with one.
+func sgrLen(b []byte) int {
+	if len(b) < 3 || b[0] != '\x1b' || b[1] != '[' {
+		return 0
+	}
+	for i := 2; i < len(b); i++ {
+		switch c := b[i]; {
+		case c == 'm':
+			return i + 1
+		case c >= '0' && c <= '9', c == ';', c == ':':
+		default:
+			return 0
+		}
+	}
+	return 0
+}
+
 // dropCR drops a terminal \r from the data.
 func dropCR(data []byte) []byte {
 	if len(data) > 0 && data[len(data)-1] == '\r' {
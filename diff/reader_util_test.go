@@ -228,3 +228,136 @@ func TestReadLine_KeepCR(t *testing.T) {
 		t.Errorf("expected line2\\r, got %q", string(l))
 	}
 }
+
+func TestStripSGR(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		want      string
+		wantSpans []ColorSpan
+	}{
+		{
+			name:  "plain",
+			input: " same line",
+			want:  " same line",
+		},
+		{
+			name:  "git_added_line",
+			input: "\x1b[32m+\x1b[m\x1b[32mhello there\x1b[m",
+			want:  "+hello there",
+			wantSpans: []ColorSpan{
+				{Offset: 0, Code: "\x1b[32m"},
+				{Offset: 1, Code: "\x1b[m"},
+				{Offset: 1, Code: "\x1b[32m"},
+				{Offset: 12, Code: "\x1b[m"},
+			},
+		},
+		{
+			name:      "bold_red",
+			input:     "\x1b[1;31m-x\x1b[0m",
+			want:      "-x",
+			wantSpans: []ColorSpan{{Offset: 0, Code: "\x1b[1;31m"}, {Offset: 2, Code: "\x1b[0m"}},
+		},
+		{
+			name:  "not_sgr",
+			input: "\x1b[2Kx\x1b",
+			want:  "\x1b[2Kx\x1b",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var spans []ColorSpan
+			got := stripSGR([]byte(test.input), &spans)
+			if string(got) != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if !reflect.DeepEqual(spans, test.wantSpans) {
+				t.Errorf("got spans %q, want %q", spans, test.wantSpans)
+			}
+		})
+	}
+}
+
+func TestLineReader_StripANSI(t *testing.T) {
+	input := "\x1b[1m--- a/f\x1b[m\n\x1b[1m+++ b/f\x1b[m\n\x1b[36m@@ -1 +1 @@\x1b[m\n"
+	in := newLineReaderOptions(strings.NewReader(input), ParseOptions{StripANSI: true})
+
+	line, err := in.readLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(line) != "--- a/f" {
+		t.Errorf("got line %q, want %q", line, "--- a/f")
+	}
+
+	for prefix, want := range map[string]bool{"+++": true, "@@ ": false} {
+		got, err := in.nextLineStartsWith(prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("nextLineStartsWith(%q): got %t, want %t", prefix, got, want)
+		}
+	}
+	for prefix, want := range map[string]bool{"@@ ": true, "+++": false} {
+		got, err := in.nextNextLineStartsWith(prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("nextNextLineStartsWith(%q): got %t, want %t", prefix, got, want)
+		}
+	}
+}
+
+func TestReadLineLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		max     int
+		want    string
+		wantErr error
+	}{
+		{name: "under_limit", input: "abc\n", max: 4, want: "abc"},
+		{name: "at_limit", input: "abcd\n", max: 4, want: "abcd"},
+		{name: "at_limit_eof", input: "abcd", max: 4, want: "abcd"},
+		{name: "over_limit", input: "abcde\n", max: 4, wantErr: ErrLineTooLong},
+		{name: "over_limit_eof", input: "abcde", max: 4, wantErr: ErrLineTooLong},
+		{name: "longer_than_buffer", input: strings.Repeat("x", 100) + "\n", max: 50, wantErr: ErrLineTooLong},
+		{name: "no_limit", input: strings.Repeat("x", 100) + "\n", want: strings.Repeat("x", 100)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in := bufio.NewReaderSize(strings.NewReader(test.input), 16)
+			l, err := readLineLimit(in, false, test.max)
+			if err != test.wantErr {
+				t.Fatalf("got err %v, want %v", err, test.wantErr)
+			}
+			if string(l) != test.want {
+				t.Errorf("got %q, want %q", l, test.want)
+			}
+		})
+	}
+}
+
+func TestLineReader_MaxTotalBytes(t *testing.T) {
+	input := "line1\nline2\nline3\n"
+	for max, wantLines := range map[int64]int{int64(len(input)): 3, 12: 2, 11: 1} {
+		in := newLineReaderOptions(strings.NewReader(input), ParseOptions{MaxTotalBytes: max})
+		var lines int
+		var err error
+		for {
+			if _, err = in.readLine(); err != nil {
+				break
+			}
+			lines++
+		}
+		wantErr := ErrInputTooLarge
+		if max == int64(len(input)) {
+			wantErr = io.EOF
+		}
+		if err != wantErr || lines != wantLines {
+			t.Errorf("max %d: got %d lines and err %v, want %d lines and err %v", max, lines, err, wantLines, wantErr)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package diff
 
 import (
-	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -54,9 +53,8 @@ func TestParseOnlyIn_KeepCR(t *testing.T) {
 	}
 
 	fd := fds[0]
-	// The path should be /tmp/file (or \tmp\file on windows, but filepath.Join is used)
-	// Actually, the code uses filepath.Join(string(source), string(filename))
-	wantOrigName := filepath.Join("/tmp", "file")
+	// Diff paths are slash-separated on every platform.
+	wantOrigName := "/tmp/file"
 	if fd.OrigName != wantOrigName {
 		t.Errorf("expected OrigName %q, got %q", wantOrigName, fd.OrigName)
 	}
@@ -66,40 +64,35 @@ func TestParseOnlyIn_KeepCR(t *testing.T) {
 	}
 }
 
-func TestNormalizeHeader_KeepCR(t *testing.T) {
+func TestParseHunkHeader_KeepCR(t *testing.T) {
 	tests := []struct {
 		name    string
 		input   string
-		wantH   string
-		wantS   string
+		want    Hunk
 		wantErr bool
 	}{
 		{
 			name:  "NoSection_CR",
 			input: "@@ -1,1 +1,1 @@\r",
-			wantH: "@@ -1,1 +1,1 @@",
-			wantS: "",
+			want:  Hunk{OrigStartLine: 1, OrigLines: 1, NewStartLine: 1, NewLines: 1},
 		},
 		{
 			name:  "WithSection_CR",
 			input: "@@ -1,1 +1,1 @@ some section\r",
-			wantH: "@@ -1,1 +1,1 @@ some section",
-			wantS: "some section",
+			want:  Hunk{OrigStartLine: 1, OrigLines: 1, NewStartLine: 1, NewLines: 1, Section: "some section"},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotH, gotS, err := normalizeHeader(tt.input)
+			var got Hunk
+			err := parseHunkHeader([]byte(tt.input), &got)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("normalizeHeader() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("parseHunkHeader() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if gotH != tt.wantH {
-				t.Errorf("normalizeHeader() gotH = %q, want %q", gotH, tt.wantH)
-			}
-			if gotS != tt.wantS {
-				t.Errorf("normalizeHeader() gotS = %q, want %q", gotS, tt.wantS)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseHunkHeader() = %+v, want %+v", got, tt.want)
 			}
 		})
 	}
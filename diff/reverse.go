@@ -10,11 +10,23 @@ import (
 // This is a FileDiff that undoes the edit of the original.
 func ReverseFileDiff(fd *FileDiff) (*FileDiff, error) {
 	reverse := FileDiff{
-		OrigName: fd.NewName,
-		OrigTime: fd.NewTime,
-		NewName:  fd.OrigName,
-		NewTime:  fd.OrigTime,
-		Extended: fd.Extended,
+		Kind:           fd.Kind,
+		OrigName:       fd.NewName,
+		OrigTime:       fd.NewTime,
+		OrigTimeLayout: fd.NewTimeLayout,
+		OrigLabel:      fd.NewLabel,
+		NewName:        fd.OrigName,
+		NewTime:        fd.OrigTime,
+		NewTimeLayout:  fd.OrigTimeLayout,
+		NewLabel:       fd.OrigLabel,
+		Preamble:       fd.Preamble,
+		Extended:       fd.Extended,
+		InvalidUTF8:    fd.InvalidUTF8,
+		Summary:        reverseSummary(fd.Summary),
+	}
+	if fd.Kind == KindOnlyIn {
+		// "Only in" names a single path, which is the same either way round.
+		reverse.OrigName, reverse.NewName = fd.OrigName, fd.NewName
 	}
 	for _, hunk := range fd.Hunks {
 		invHunk, err := reverseHunk(hunk)
@@ -39,6 +51,27 @@ func ReverseMultiFileDiff(fds []*FileDiff) ([]*FileDiff, error) {
 	return reverse, nil
 }
 
+// reverseSummary swaps the orig and new sides of a FileSummary.
+func reverseSummary(s *FileSummary) *FileSummary {
+	if s == nil {
+		return nil
+	}
+	reverse := *s
+	reverse.OrigMode, reverse.NewMode = s.NewMode, s.OrigMode
+	reverse.OrigHash, reverse.NewHash = s.NewHash, s.OrigHash
+	reverse.OrigSize, reverse.NewSize = s.NewSize, s.OrigSize
+	switch s.Status {
+	case StatusAdded:
+		reverse.Status = StatusDeleted
+	case StatusDeleted:
+		reverse.Status = StatusAdded
+	}
+	if s.Stat != nil {
+		reverse.Stat = &Stat{Added: s.Stat.Deleted, Changed: s.Stat.Changed, Deleted: s.Stat.Added}
+	}
+	return &reverse
+}
+
 // A subhunk represents a portion of a Hunk.Body, split into three sections.
 // It consists of zero or more context lines, followed by zero or more orig
 // lines and then zero or more new lines.
@@ -70,6 +103,12 @@ func reverseHunk(forward *Hunk) (*Hunk, error) {
 		Section:         forward.Section,
 		StartPosition:   forward.StartPosition,
 	}
+	crlf := len(forward.CRLFLines) > 0
+	if crlf {
+		// Put the carriage returns back in the body, so that they move
+		// with their lines.
+		forward = convertHunkLineEndings(forward, LineEndingsPreserve)
+	}
 	subs, err := toSubhunks(forward)
 	if err != nil {
 		return nil, err
@@ -103,6 +142,9 @@ func reverseHunk(forward *Hunk) (*Hunk, error) {
 			reverse.Body = append(reverse.Body, line...)
 		}
 	}
+	if crlf {
+		recordCRLF(&reverse)
+	}
 	return &reverse, nil
 }
 
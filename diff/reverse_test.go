@@ -216,3 +216,23 @@ func TestReverseRoundTripOnTestdata(t *testing.T) {
 		})
 	}
 }
+
+func TestReverseFileDiff_Summary(t *testing.T) {
+	fd := &FileDiff{
+		OrigName: "a.txt",
+		NewName:  "a.txt",
+		Summary:  &FileSummary{Status: StatusAdded, NewMode: 0100644, OrigHash: "0000000", NewHash: "8ba3a16", Stat: &Stat{Added: 3}},
+	}
+	want := &FileDiff{
+		OrigName: "a.txt",
+		NewName:  "a.txt",
+		Summary:  &FileSummary{Status: StatusDeleted, OrigMode: 0100644, OrigHash: "8ba3a16", NewHash: "0000000", Stat: &Stat{Deleted: 3}},
+	}
+	got, err := ReverseFileDiff(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("got - want:\n%s", cmp.Diff(want, got))
+	}
+}
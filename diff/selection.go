@@ -0,0 +1,64 @@
+package diff
+
+import "bytes"
+
+// SelectLines returns a copy of d that only makes the changes of the
+// selected lines, as when staging some lines of a hunk with "git add -p".
+// selected is called for each '-' and '+' line with the index of its hunk
+// in d.Hunks and the 0-indexed line of the hunk's body.
+//
+// A '-' line that is not selected becomes a context line, and a '+' line
+// that is not selected is dropped. The hunk headers are recounted, and
+// hunks that are left without changes are dropped.
+func SelectLines(d *FileDiff, selected func(hunk, line int) bool) (*FileDiff, error) {
+	c := *d
+	c.Hunks = nil
+	// delta is how many lines the hunks so far add.
+	var delta int32
+	for i, h := range d.Hunks {
+		lines, err := hunkLines(h)
+		if err != nil {
+			return nil, err
+		}
+		kept := make([]hunkLine, 0, len(lines))
+		for j, l := range lines {
+			switch {
+			case l.op == ' ' || selected(i, j):
+				kept = append(kept, l)
+			case l.op == '-':
+				kept = append(kept, hunkLine{' ', l.text})
+			}
+		}
+		kept = fixNoNewlineContext(kept)
+		if !hasChanges(kept) {
+			continue
+		}
+
+		origBegin := hunkBegin(h.OrigStartLine, h.OrigLines)
+		s := buildHunk(origBegin, origBegin+delta, h.Section, kept)
+		if len(h.CRLFLines) > 0 {
+			recordCRLF(s)
+		}
+		delta += s.NewLines - s.OrigLines
+		c.Hunks = append(c.Hunks, s)
+	}
+	return &c, nil
+}
+
+// fixNoNewlineContext replaces a context line without a newline that is not
+// the last line (which happens when the removal of the last line of the
+// original file is not selected, but lines added after it are) by its
+// removal and its addition with a newline.
+func fixNoNewlineContext(lines []hunkLine) []hunkLine {
+	for i, l := range lines {
+		if l.op == ' ' && i < len(lines)-1 && !bytes.HasSuffix(l.text, []byte{'\n'}) {
+			fixed := append([]hunkLine(nil), lines[:i]...)
+			fixed = append(fixed,
+				hunkLine{'-', l.text},
+				hunkLine{'+', append(l.text[:len(l.text):len(l.text)], '\n')},
+			)
+			return append(fixed, lines[i+1:]...)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,58 @@
+package diff
+
+import "testing"
+
+func TestSelectLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		hunks    string
+		selected map[[2]int]bool
+		want     string
+	}{
+		{
+			name:     "some lines",
+			hunks:    "@@ -1,4 +1,4 @@\n a\n-b\n-c\n+B\n+C\n d\n",
+			selected: map[[2]int]bool{{0, 1}: true, {0, 3}: true},
+			want:     "@@ -1,4 +1,4 @@\n a\n-b\n c\n+B\n d\n",
+		},
+		{
+			name:     "hunk dropped",
+			hunks:    "@@ -1,2 +1,3 @@\n a\n+x\n b\n@@ -5,2 +6,2 @@\n e\n-f\n+F\n",
+			selected: map[[2]int]bool{{1, 1}: true, {1, 2}: true},
+			want:     "@@ -5,2 +5,2 @@\n e\n-f\n+F\n",
+		},
+		{
+			name:     "no newline removed",
+			hunks:    "@@ -1,2 +1,3 @@\n a\n-b\n\\ No newline at end of file\n+b\n+c\n",
+			selected: map[[2]int]bool{{0, 1}: true},
+			want:     "@@ -1,2 +1,1 @@\n a\n-b\n\\ No newline at end of file\n",
+		},
+		{
+			name:     "no newline kept",
+			hunks:    "@@ -1,2 +1,3 @@\n a\n-b\n\\ No newline at end of file\n+b\n+c\n",
+			selected: map[[2]int]bool{{0, 3}: true},
+			want:     "@@ -1,2 +1,3 @@\n a\n-b\n\\ No newline at end of file\n+b\n+c\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hunks, err := ParseHunks([]byte(test.hunks))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fd, err := SelectLines(&FileDiff{Hunks: hunks}, func(hunk, line int) bool {
+				return test.selected[[2]int{hunk, line}]
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := PrintHunks(fd.Hunks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package diff
+
+// OrigText returns the lines of the original file that the hunk covers: its
+// context and '-' lines, without their prefixes. The last line has no
+// newline if the original file does not end in one. It returns nil if the
+// hunk's body is malformed.
+func (h *Hunk) OrigText() []byte {
+	return h.sideText('+')
+}
+
+// NewText returns the lines of the new file that the hunk covers: its
+// context and '+' lines, without their prefixes (see OrigText).
+func (h *Hunk) NewText() []byte {
+	return h.sideText('-')
+}
+
+// sideText returns the text of the body lines of h whose op is not skip.
+func (h *Hunk) sideText(skip byte) []byte {
+	lines, err := bodyLines(h)
+	if err != nil {
+		return nil
+	}
+	var text []byte
+	for _, l := range lines {
+		if l.op != skip {
+			text = append(text, l.text...)
+		}
+	}
+	return text
+}
+
+// A Fragment is the part of the original or new file that a hunk covers.
+type Fragment struct {
+	// StartLine is the 1-indexed line at which the fragment starts (for
+	// an empty fragment, the line after it).
+	StartLine int32
+	// Lines is the number of lines of the fragment.
+	Lines int32
+	// Text is the fragment's lines (see Hunk.OrigText).
+	Text []byte
+}
+
+// OrigFragments returns the parts of the original file that the hunks of d
+// cover, one for each hunk.
+func (d *FileDiff) OrigFragments() []Fragment {
+	return d.fragments(true)
+}
+
+// NewFragments returns the parts of the new file that the hunks of d cover,
+// one for each hunk.
+func (d *FileDiff) NewFragments() []Fragment {
+	return d.fragments(false)
+}
+
+func (d *FileDiff) fragments(orig bool) []Fragment {
+	var fragments []Fragment
+	for _, h := range d.Hunks {
+		f := Fragment{StartLine: hunkBegin(h.NewStartLine, h.NewLines) + 1, Lines: h.NewLines, Text: h.NewText()}
+		if orig {
+			f = Fragment{StartLine: hunkBegin(h.OrigStartLine, h.OrigLines) + 1, Lines: h.OrigLines, Text: h.OrigText()}
+		}
+		fragments = append(fragments, f)
+	}
+	return fragments
+}
+
+// OrigFile returns the whole original file, if the hunks of d are known to
+// cover all of it (as in a diff of an added or deleted file, or with
+// full-file context). ok is false if they are not. Since a diff does not
+// say how long a file is, the hunks must start at the first line, have no
+// gaps between them, and show where the file ends: the other side is
+// /dev/null, a side of the last hunk has no newline at its end, or the last
+// hunk has fewer context lines after its changes than before them (which a
+// diff only has at the end of the file).
+func (d *FileDiff) OrigFile() (text []byte, ok bool) {
+	return d.file(true)
+}
+
+// NewFile returns the whole new file, if the hunks of d are known to cover
+// all of it (see OrigFile).
+func (d *FileDiff) NewFile() (text []byte, ok bool) {
+	return d.file(false)
+}
+
+func (d *FileDiff) file(orig bool) ([]byte, bool) {
+	fragments := d.fragments(orig)
+	if len(fragments) == 0 {
+		name := d.NewName
+		if orig {
+			name = d.OrigName
+		}
+		return nil, name == devNull
+	}
+	if !d.endKnown() {
+		return nil, false
+	}
+	text := []byte{}
+	next := int32(1)
+	for _, f := range fragments {
+		if f.StartLine != next || (f.Lines > 0 && f.Text == nil) {
+			return nil, false
+		}
+		text = append(text, f.Text...)
+		next += f.Lines
+	}
+	return text, true
+}
+
+// endKnown reports whether the last hunk of d is known to reach the end of
+// the file (see OrigFile). Since the files are the same after the last
+// hunk, it then does on both sides.
+func (d *FileDiff) endKnown() bool {
+	if d.OrigName == devNull || d.NewName == devNull {
+		return true
+	}
+	h := d.Hunks[len(d.Hunks)-1]
+	for _, text := range [][]byte{h.OrigText(), h.NewText()} {
+		if len(text) > 0 && text[len(text)-1] != '\n' {
+			return true
+		}
+	}
+	lines, err := hunkLines(h)
+	if err != nil {
+		return false
+	}
+	var before, after int
+	for before < len(lines) && lines[before].op == ' ' {
+		before++
+	}
+	for after < len(lines)-before && lines[len(lines)-1-after].op == ' ' {
+		after++
+	}
+	return before < len(lines) && after < before
+}
@@ -0,0 +1,117 @@
+package diff
+
+import "testing"
+
+func TestHunk_OrigText(t *testing.T) {
+	tests := []struct {
+		hunk      string
+		orig, new string
+	}{
+		{
+			hunk: "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			orig: "a\nb\nc\n",
+			new:  "a\nB\nc\n",
+		},
+		{
+			hunk: "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+			orig: "a\nb",
+			new:  "a\nb\n",
+		},
+		{
+			hunk: "@@ -1,2 +1,2 @@\n a\n-b\n+B\n\\ No newline at end of file\n",
+			orig: "a\nb\n",
+			new:  "a\nB",
+		},
+	}
+	for _, test := range tests {
+		hunks, err := ParseHunks([]byte(test.hunk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(hunks[0].OrigText()); got != test.orig {
+			t.Errorf("OrigText: got %q, want %q", got, test.orig)
+		}
+		if got := string(hunks[0].NewText()); got != test.new {
+			t.Errorf("NewText: got %q, want %q", got, test.new)
+		}
+	}
+}
+
+func TestFileDiff_OrigFile(t *testing.T) {
+	fds, err := ParseMultiFileDiff([]byte(`--- a/full
++++ b/full
+@@ -1,2 +1,2 @@
+ a
+-b
++B
+@@ -3,1 +3,2 @@
+ c
++d
+--- a/partial
++++ b/partial
+@@ -3,3 +3,3 @@
+ c
+-d
++D
+ e
+--- /dev/null
++++ b/added
+@@ -0,0 +1,2 @@
++x
++y
+--- a/start
++++ b/start
+@@ -1,4 +1,4 @@
+-a
++A
+ b
+ c
+ d
+--- a/nonewline
++++ b/nonewline
+@@ -1 +1 @@
+-a
++b
+\ No newline at end of file
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	full := fds[0]
+	frags := full.NewFragments()
+	if len(frags) != 2 || frags[1].StartLine != 3 || frags[1].Lines != 2 || string(frags[1].Text) != "c\nd\n" {
+		t.Errorf("got new fragments %+v", frags)
+	}
+	if text, ok := full.OrigFile(); !ok || string(text) != "a\nb\nc\n" {
+		t.Errorf("OrigFile: got %q, %v", text, ok)
+	}
+	if text, ok := full.NewFile(); !ok || string(text) != "a\nB\nc\nd\n" {
+		t.Errorf("NewFile: got %q, %v", text, ok)
+	}
+
+	if _, ok := fds[1].OrigFile(); ok {
+		t.Error("OrigFile: got ok for a partial diff")
+	}
+
+	// A change of the first line of a longer file, with 3 lines of
+	// context, starts at the first line but does not show where the file
+	// ends.
+	if text, ok := fds[3].OrigFile(); ok {
+		t.Errorf("OrigFile of the start of a file: got %q, want not ok", text)
+	}
+	if text, ok := fds[3].NewFile(); ok {
+		t.Errorf("NewFile of the start of a file: got %q, want not ok", text)
+	}
+	// The file ends where the new side's last line has no newline.
+	if text, ok := fds[4].NewFile(); !ok || string(text) != "b" {
+		t.Errorf("NewFile without a newline at the end: got %q, %v", text, ok)
+	}
+
+	if text, ok := fds[2].OrigFile(); !ok || len(text) != 0 {
+		t.Errorf("OrigFile of added file: got %q, %v", text, ok)
+	}
+	if text, ok := fds[2].NewFile(); !ok || string(text) != "x\ny\n" {
+		t.Errorf("NewFile of added file: got %q, %v", text, ok)
+	}
+}
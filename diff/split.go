@@ -0,0 +1,58 @@
+package diff
+
+import "errors"
+
+// SplitHunk splits h into the smallest hunks that can be applied on their
+// own: one for each run of changed lines, with all the context lines
+// around it in h. Consecutive hunks share the context lines between their
+// changes, as with "git add -p". The headers are recomputed; each hunk's
+// new start line assumes the hunks before it were applied too. The returned
+// hunks are new and share no memory with h, even if h is not split.
+func SplitHunk(h *Hunk) ([]*Hunk, error) {
+	changes, err := hunkChanges([]*Hunk{h})
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) <= 1 {
+		c := *h
+		c.Body = append([]byte(nil), h.Body...)
+		c.ColorSpans = append([]ColorSpan(nil), h.ColorSpans...)
+		c.CRLFLines = append([]int32(nil), h.CRLFLines...)
+		return []*Hunk{&c}, nil
+	}
+	hunks := make([]*Hunk, len(changes))
+	for i := range changes {
+		hunks[i] = joinChanges(changes[i : i+1])[0]
+		if len(h.CRLFLines) > 0 {
+			recordCRLF(hunks[i])
+		}
+	}
+	return hunks, nil
+}
+
+// MergeHunks merges consecutive hunks of a file whose context lines overlap
+// or meet, such as hunks returned by SplitHunk, and returns the resulting
+// hunks. hunks must be in order and must not change the same lines.
+func MergeHunks(hunks []*Hunk) ([]*Hunk, error) {
+	changes, err := hunkChanges(hunks)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(changes); i++ {
+		prev, c := &changes[i-1], &changes[i]
+		origGap := c.orig - (prev.orig + prev.origLines())
+		newGap := c.new - (prev.new + prev.newLines())
+		if origGap < 0 || origGap != newGap {
+			return nil, errMergeHunks
+		}
+	}
+	merged := joinChanges(changes)
+	if anyCRLFLines(hunks) {
+		for _, h := range merged {
+			recordCRLF(h)
+		}
+	}
+	return merged, nil
+}
+
+var errMergeHunks = errors.New("hunks to merge overlap or are out of order")
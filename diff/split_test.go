@@ -0,0 +1,104 @@
+package diff
+
+import "testing"
+
+func TestSplitHunk(t *testing.T) {
+	tests := []struct {
+		hunk string
+		want []string
+	}{
+		{
+			hunk: "@@ -1,7 +1,7 @@\n a\n-b\n+B\n c\n d\n-e\n+E\n f\n g\n",
+			want: []string{
+				"@@ -1,4 +1,4 @@\n a\n-b\n+B\n c\n d\n",
+				"@@ -3,5 +3,5 @@\n c\n d\n-e\n+E\n f\n g\n",
+			},
+		},
+		{
+			hunk: "@@ -1,5 +1,5 @@\n a\n+x\n b\n c\n-d\n e\n",
+			want: []string{
+				"@@ -1,3 +1,4 @@\n a\n+x\n b\n c\n",
+				"@@ -2,4 +3,3 @@\n b\n c\n-d\n e\n",
+			},
+		},
+		{
+			hunk: "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			want: []string{"@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		},
+	}
+	for _, test := range tests {
+		hunks, err := ParseHunks([]byte(test.hunk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		split, err := SplitHunk(hunks[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(split) != len(test.want) {
+			t.Fatalf("got %d hunks, want %d", len(split), len(test.want))
+		}
+		for i, h := range split {
+			got, err := PrintHunks([]*Hunk{h})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want[i] {
+				t.Errorf("hunk %d: got\n%s\nwant\n%s", i, got, test.want[i])
+			}
+		}
+
+		merged, err := MergeHunks(split)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := PrintHunks(merged)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.hunk {
+			t.Errorf("merged: got\n%s\nwant\n%s", got, test.hunk)
+		}
+	}
+}
+
+func TestSplitHunk_Copy(t *testing.T) {
+	hunks, err := ParseHunks([]byte("@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	split, err := SplitHunk(hunks[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(split) != 1 || split[0] == hunks[0] {
+		t.Fatalf("got %v, want a copy of the hunk", split)
+	}
+	split[0].Body[1] = 'x'
+	split[0].OrigStartLine = 5
+	if want := " a\n-b\n+B\n c\n"; string(hunks[0].Body) != want || hunks[0].OrigStartLine != 1 {
+		t.Errorf("changing the split hunk changed h: got body %q at line %d, want %q at line 1", hunks[0].Body, hunks[0].OrigStartLine, want)
+	}
+}
+
+func TestMergeHunks(t *testing.T) {
+	hunks, err := ParseHunks([]byte("@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n@@ -4,3 +4,3 @@\n d\n-e\n+E\n f\n@@ -10,3 +10,3 @@\n j\n-k\n+K\n l\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err := MergeHunks(hunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := PrintHunks(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "@@ -1,6 +1,6 @@\n a\n-b\n+B\n c\n d\n-e\n+E\n f\n@@ -10,3 +10,3 @@\n j\n-k\n+K\n l\n"; string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := MergeHunks([]*Hunk{hunks[1], hunks[0]}); err == nil {
+		t.Error("got no error merging hunks out of order")
+	}
+}
@@ -0,0 +1,481 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A SummaryFormat is one of git's per-file summary output formats, which
+// describe what changed in each file without including hunks.
+type SummaryFormat int
+
+const (
+	// SummaryRaw is `git diff --raw`:
+	//
+	//	:100644 100644 bcd1234 0123456 M	file0
+	//	:100644 100644 abcd123 1234567 R86	file1	file3
+	SummaryRaw SummaryFormat = iota
+
+	// SummaryNumstat is `git diff --numstat`:
+	//
+	//	3	1	file0
+	//	-	-	image.png
+	SummaryNumstat
+
+	// SummaryStat is `git diff --stat`:
+	//
+	//	 file0     | 4 +++-
+	//	 image.png | Bin 2 -> 3 bytes
+	//	 2 files changed, 3 insertions(+), 1 deletion(-)
+	//
+	// Paths may be abbreviated by git to fit the terminal width, and line
+	// counts are derived from the +/- graph, which git scales down for
+	// large changes (see FileSummary.Stat).
+	SummaryStat
+)
+
+// A FileStatus is git's one-letter status of a changed file.
+type FileStatus byte
+
+const (
+	StatusAdded       FileStatus = 'A'
+	StatusCopied      FileStatus = 'C'
+	StatusDeleted     FileStatus = 'D'
+	StatusModified    FileStatus = 'M'
+	StatusRenamed     FileStatus = 'R'
+	StatusTypeChanged FileStatus = 'T'
+	StatusUnmerged    FileStatus = 'U'
+	StatusUnknown     FileStatus = 'X'
+)
+
+// A FileMode is a git file mode (e.g., 0100644 for a regular file). Zero
+// means the file does not exist on that side.
+type FileMode uint32
+
+// String returns the mode in octal, as git prints it.
+func (m FileMode) String() string {
+	return fmt.Sprintf("%06o", uint32(m))
+}
+
+// A FileSummary holds the per-file information printed by git's summary
+// formats. Which fields are set depends on the format that was read.
+type FileSummary struct {
+	// status of the file (--raw only)
+	Status FileStatus
+	// similarity percentage of a rename or copy, or dissimilarity
+	// percentage of a rewrite (--raw only; 0 if not shown)
+	Score int32
+	// modes before and after (--raw only)
+	OrigMode, NewMode FileMode
+	// abbreviated or full object names before and after (--raw only)
+	OrigHash, NewHash string
+	// number of lines added and deleted (--numstat and --stat); nil if
+	// unknown or if the file is binary. For --stat, the split between
+	// added and deleted lines is estimated from the graph when git scaled
+	// it down.
+	Stat *Stat
+	// whether git treated the file as binary (--numstat and --stat)
+	Binary bool
+	// binary file sizes in bytes before and after (--stat only)
+	OrigSize, NewSize int64
+}
+
+// ParseSummary parses the output of `git diff --raw`, `--numstat` or
+// `--stat` (as given by format). The FileDiffs it returns have Summary set
+// and no hunks.
+func ParseSummary(diff []byte, format SummaryFormat) ([]*FileDiff, error) {
+	return ParseSummaryOptions(diff, format, ParseOptions{})
+}
+
+// ParseSummaryOptions parses summary output with the given options.
+func ParseSummaryOptions(diff []byte, format SummaryFormat, opts ParseOptions) ([]*FileDiff, error) {
+	return NewSummaryReaderOptions(bytes.NewReader(diff), format, opts).ReadAllFiles()
+}
+
+// NewSummaryReader returns a new SummaryReader that reads summary output in
+// the given format from r.
+func NewSummaryReader(r io.Reader, format SummaryFormat) *SummaryReader {
+	return NewSummaryReaderOptions(r, format, ParseOptions{})
+}
+
+// NewSummaryReaderOptions returns a new SummaryReader that reads summary
+// output in the given format from r with the given options.
+func NewSummaryReaderOptions(r io.Reader, format SummaryFormat, opts ParseOptions) *SummaryReader {
+	return &SummaryReader{reader: newLineReaderOptions(r, opts), format: format}
+}
+
+// A SummaryReader reads the output of `git diff --raw`, `--numstat` or
+// `--stat`.
+type SummaryReader struct {
+	line   int
+	offset int64
+	reader *lineReader
+	format SummaryFormat
+}
+
+// ReadFile reads the summary of the next file. If there are no more files,
+// it returns error io.EOF. For --stat, the closing "N files changed" line
+// ends the input.
+func (r *SummaryReader) ReadFile() (*FileDiff, error) {
+	for {
+		line, err := r.reader.readLine()
+		if err != nil {
+			return nil, err
+		}
+		r.line++
+		r.offset += int64(len(line))
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var fd *FileDiff
+		switch r.format {
+		case SummaryRaw:
+			fd, err = parseRawLine(string(line))
+		case SummaryNumstat:
+			fd, err = parseNumstatLine(string(line))
+		case SummaryStat:
+			if isStatSummaryLine(string(line)) {
+				return nil, io.EOF
+			}
+			fd, err = parseStatLine(string(line))
+		default:
+			return nil, fmt.Errorf("unknown summary format %d", r.format)
+		}
+		if err != nil {
+			return nil, &ParseError{r.line, r.offset, err}
+		}
+		return fd, nil
+	}
+}
+
+// ReadAllFiles reads the summaries of all remaining files.
+func (r *SummaryReader) ReadAllFiles() ([]*FileDiff, error) {
+	var ds []*FileDiff
+	for {
+		d, err := r.ReadFile()
+		if err == io.EOF {
+			return ds, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+}
+
+// ErrBadSummaryLine is when a line that is not valid in the summary format
+// being read is encountered.
+type ErrBadSummaryLine struct {
+	Line string
+}
+
+func (e *ErrBadSummaryLine) Error() string {
+	return "bad summary line: " + e.Line
+}
+
+// parseRawLine parses one line of `git diff --raw` output.
+func parseRawLine(line string) (*FileDiff, error) {
+	bad := &ErrBadSummaryLine{Line: line}
+	if !strings.HasPrefix(line, ":") {
+		return nil, bad
+	}
+	tab := strings.IndexByte(line, '\t')
+	if tab < 0 {
+		return nil, bad
+	}
+	fields := strings.Fields(line[1:tab])
+	if len(fields) != 5 || fields[4] == "" {
+		return nil, bad
+	}
+
+	s := &FileSummary{
+		Status:   FileStatus(fields[4][0]),
+		OrigHash: fields[2],
+		NewHash:  fields[3],
+	}
+	for i, mode := range []*FileMode{&s.OrigMode, &s.NewMode} {
+		m, err := strconv.ParseUint(fields[i], 8, 32)
+		if err != nil {
+			return nil, bad
+		}
+		*mode = FileMode(m)
+	}
+	if score := fields[4][1:]; score != "" {
+		n, err := strconv.ParseInt(score, 10, 32)
+		if err != nil {
+			return nil, bad
+		}
+		s.Score = int32(n)
+	}
+
+	paths := strings.Split(line[tab+1:], "\t")
+	fd := &FileDiff{Summary: s}
+	switch len(paths) {
+	case 1:
+		fd.OrigName = unquoteSummaryPath(paths[0])
+		fd.NewName = fd.OrigName
+	case 2:
+		fd.OrigName = unquoteSummaryPath(paths[0])
+		fd.NewName = unquoteSummaryPath(paths[1])
+	default:
+		return nil, bad
+	}
+	return fd, nil
+}
+
+// parseNumstatLine parses one line of `git diff --numstat` output.
+func parseNumstatLine(line string) (*FileDiff, error) {
+	parts := strings.SplitN(line, "\t", 3)
+	if len(parts) != 3 {
+		return nil, &ErrBadSummaryLine{Line: line}
+	}
+	s := &FileSummary{}
+	if parts[0] == "-" && parts[1] == "-" {
+		s.Binary = true
+	} else {
+		added, err1 := strconv.ParseInt(parts[0], 10, 32)
+		deleted, err2 := strconv.ParseInt(parts[1], 10, 32)
+		if err1 != nil || err2 != nil {
+			return nil, &ErrBadSummaryLine{Line: line}
+		}
+		s.Stat = &Stat{Added: int32(added), Deleted: int32(deleted)}
+	}
+
+	fd := &FileDiff{Summary: s}
+	fd.OrigName, fd.NewName = splitRenamePath(unquoteSummaryPath(parts[2]))
+	return fd, nil
+}
+
+// isStatSummaryLine reports whether line is the last line of `git diff
+// --stat` output (e.g., " 2 files changed, 3 insertions(+), 1 deletion(-)").
+func isStatSummaryLine(line string) bool {
+	line = strings.TrimSpace(line)
+	return !strings.Contains(line, "|") &&
+		(strings.Contains(line, " file changed") || strings.Contains(line, " files changed"))
+}
+
+// parseStatLine parses one line of `git diff --stat` output.
+func parseStatLine(line string) (*FileDiff, error) {
+	bar := strings.LastIndex(line, " | ")
+	if bar < 0 {
+		return nil, &ErrBadSummaryLine{Line: line}
+	}
+	name := strings.TrimSpace(line[:bar])
+	info := strings.TrimSpace(line[bar+len(" | "):])
+
+	s := &FileSummary{}
+	if strings.HasPrefix(info, "Bin") {
+		s.Binary = true
+		// "Bin 2 -> 3 bytes", or just "Bin" if the contents are unchanged.
+		var orig, new int64
+		if n, _ := fmt.Sscanf(info, "Bin %d -> %d bytes", &orig, &new); n == 2 {
+			s.OrigSize, s.NewSize = orig, new
+		}
+	} else {
+		fields := strings.Fields(info)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, &ErrBadSummaryLine{Line: line}
+		}
+		total, err := strconv.ParseInt(fields[0], 10, 32)
+		if err != nil {
+			return nil, &ErrBadSummaryLine{Line: line}
+		}
+		var graph string
+		if len(fields) == 2 {
+			graph = fields[1]
+		}
+		plus := int64(strings.Count(graph, "+"))
+		minus := int64(strings.Count(graph, "-"))
+		if plus+minus != int64(len(graph)) {
+			return nil, &ErrBadSummaryLine{Line: line}
+		}
+		st := &Stat{}
+		switch {
+		case plus+minus == total:
+			st.Added, st.Deleted = int32(plus), int32(minus)
+		case plus+minus > 0:
+			// git scaled the graph down to fit; split the total
+			// proportionally.
+			added := (total*plus + (plus+minus)/2) / (plus + minus)
+			st.Added, st.Deleted = int32(added), int32(total-added)
+		}
+		s.Stat = st
+	}
+
+	fd := &FileDiff{Summary: s}
+	fd.OrigName, fd.NewName = splitRenamePath(unquoteSummaryPath(name))
+	return fd, nil
+}
+
+// unquoteSummaryPath unquotes a path that git quoted because it contains
+// special characters.
+func unquoteSummaryPath(p string) string {
+	if unquoted, err := strconv.Unquote(p); err == nil {
+		return unquoted
+	}
+	return p
+}
+
+// splitRenamePath expands the rename notation used by --numstat and --stat,
+// "old => new" or "dir/{old => new}/file", into both paths.
+func splitRenamePath(p string) (origName, newName string) {
+	const arrow = " => "
+	if open := strings.IndexByte(p, '{'); open >= 0 {
+		if close := strings.IndexByte(p[open:], '}'); close >= 0 {
+			close += open
+			inner := p[open+1 : close]
+			if i := strings.Index(inner, arrow); i >= 0 {
+				prefix, suffix := p[:open], p[close+1:]
+				origName = joinRenamePart(prefix, inner[:i], suffix)
+				newName = joinRenamePart(prefix, inner[i+len(arrow):], suffix)
+				return origName, newName
+			}
+		}
+	}
+	if i := strings.Index(p, arrow); i >= 0 {
+		return p[:i], p[i+len(arrow):]
+	}
+	return p, p
+}
+
+// joinRenamePart joins the pieces of a path written in the "{old => new}"
+// notation, where either side of the arrow may be empty (e.g.,
+// "{ => dir}/file").
+func joinRenamePart(prefix, middle, suffix string) string {
+	if middle == "" && strings.HasSuffix(prefix, "/") && strings.HasPrefix(suffix, "/") {
+		suffix = suffix[1:]
+	}
+	return prefix + middle + suffix
+}
+
+// PrintSummary prints file summaries in the given format. Only SummaryRaw
+// and SummaryNumstat can be printed; git's --stat output depends on the
+// terminal width.
+func PrintSummary(ds []*FileDiff, format SummaryFormat) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, d := range ds {
+		s := d.Summary
+		if s == nil {
+			s = &FileSummary{}
+		}
+		var err error
+		switch format {
+		case SummaryRaw:
+			err = printRawLine(&buf, d, s)
+		case SummaryNumstat:
+			err = printNumstatLine(&buf, d, s)
+		default:
+			err = fmt.Errorf("cannot print summary format %d", format)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func printRawLine(w io.Writer, d *FileDiff, s *FileSummary) error {
+	status := string(s.Status)
+	if s.Score > 0 {
+		status += fmt.Sprintf("%03d", s.Score)
+	}
+	if _, err := fmt.Fprintf(w, ":%s %s %s %s %s\t%s", s.OrigMode, s.NewMode, s.OrigHash, s.NewHash, status, quoteSummaryPath(d.OrigName)); err != nil {
+		return err
+	}
+	if s.Status == StatusRenamed || s.Status == StatusCopied {
+		if _, err := fmt.Fprintf(w, "\t%s", quoteSummaryPath(d.NewName)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+func printNumstatLine(w io.Writer, d *FileDiff, s *FileSummary) error {
+	added, deleted := "-", "-"
+	if s.Stat != nil {
+		added, deleted = strconv.Itoa(int(s.Stat.Added)), strconv.Itoa(int(s.Stat.Deleted))
+	}
+	name := quoteSummaryPath(d.NewName)
+	if d.OrigName != d.NewName {
+		name = renamePath(d.OrigName, d.NewName)
+	}
+	_, err := fmt.Fprintf(w, "%s\t%s\t%s\n", added, deleted, name)
+	return err
+}
+
+// renamePath writes a rename in the "dir/{old => new}/file" notation,
+// factoring out the common leading and trailing path components as git
+// does. The leading and trailing parts may share a slash, as in
+// "src/{ => sub}/file".
+func renamePath(origName, newName string) string {
+	prefix := 0
+	for i := 0; i < len(origName) && i < len(newName) && origName[i] == newName[i]; i++ {
+		if origName[i] == '/' {
+			prefix = i + 1
+		}
+	}
+	suffix := 0
+	for i := 1; i <= len(origName) && i <= len(newName) && origName[len(origName)-i] == newName[len(newName)-i]; i++ {
+		if len(origName)-i < prefix-1 || len(newName)-i < prefix-1 {
+			break
+		}
+		if origName[len(origName)-i] == '/' {
+			suffix = i
+		}
+	}
+	if prefix == 0 && suffix == 0 {
+		return origName + " => " + newName
+	}
+	middle := func(name string) string {
+		end := len(name) - suffix
+		if end < prefix {
+			end = prefix
+		}
+		return name[prefix:end]
+	}
+	return origName[:prefix] + "{" + middle(origName) + " => " + middle(newName) + "}" + origName[len(origName)-suffix:]
+}
+
+// quoteSummaryPath quotes a path the way git does if it contains control
+// characters, quotes, backslashes or non-ASCII bytes (which git writes as
+// octal escapes).
+func quoteSummaryPath(p string) string {
+	needsQuote := false
+	for i := 0; i < len(p); i++ {
+		if c := p[i]; c < 0x20 || c >= 0x7f || c == '"' || c == '\\' {
+			needsQuote = true
+			break
+		}
+	}
+	if !needsQuote {
+		return p
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(&b, "\\%03o", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,157 @@
+package diff
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSummary(t *testing.T) {
+	tests := []struct {
+		filename  string
+		format    SummaryFormat
+		wantDiffs []*FileDiff
+		printable bool
+	}{
+		{
+			filename:  "sample_summary.raw",
+			format:    SummaryRaw,
+			printable: true,
+			wantDiffs: []*FileDiff{
+				{OrigName: "add.txt", NewName: "add.txt", Summary: &FileSummary{Status: StatusAdded, NewMode: 0100644, OrigHash: "0000000", NewHash: "8ba3a16"}},
+				{OrigName: "big.txt", NewName: "big.txt", Summary: &FileSummary{Status: StatusAdded, NewMode: 0100644, OrigHash: "0000000", NewHash: "e9f1816"}},
+				{OrigName: "bin.dat", NewName: "bin.dat", Summary: &FileSummary{Status: StatusModified, OrigMode: 0100644, NewMode: 0100644, OrigHash: "bdc955b", NewHash: "350ed01"}},
+				{OrigName: "del.txt", NewName: "del.txt", Summary: &FileSummary{Status: StatusDeleted, OrigMode: 0100644, OrigHash: "286c5f5", NewHash: "0000000"}},
+				{OrigName: "dir/old.txt", NewName: "dir/new.txt", Summary: &FileSummary{Status: StatusRenamed, Score: 97, OrigMode: 0100644, NewMode: 0100644, OrigHash: "96cc558", NewHash: "1c5a36f"}},
+				{OrigName: "exec.sh", NewName: "exec.sh", Summary: &FileSummary{Status: StatusModified, OrigMode: 0100644, NewMode: 0100755, OrigHash: "587be6b", NewHash: "587be6b"}},
+				{OrigName: "mod.txt", NewName: "mod.txt", Summary: &FileSummary{Status: StatusModified, OrigMode: 0100644, NewMode: 0100644, OrigHash: "7898192", NewHash: "9ddeb5c"}},
+				{OrigName: "sp ace.txt", NewName: "sp ace.txt", Summary: &FileSummary{Status: StatusModified, OrigMode: 0100644, NewMode: 0100644, OrigHash: "bca70f3", NewHash: "8a08eba"}},
+			},
+		},
+		{
+			filename:  "sample_summary.numstat",
+			format:    SummaryNumstat,
+			printable: true,
+			wantDiffs: []*FileDiff{
+				{OrigName: "add.txt", NewName: "add.txt", Summary: &FileSummary{Stat: &Stat{Added: 1}}},
+				{OrigName: "big.txt", NewName: "big.txt", Summary: &FileSummary{Stat: &Stat{Added: 300}}},
+				{OrigName: "bin.dat", NewName: "bin.dat", Summary: &FileSummary{Binary: true}},
+				{OrigName: "del.txt", NewName: "del.txt", Summary: &FileSummary{Stat: &Stat{Deleted: 1}}},
+				{OrigName: "dir/old.txt", NewName: "dir/new.txt", Summary: &FileSummary{Stat: &Stat{Added: 1}}},
+				{OrigName: "exec.sh", NewName: "exec.sh", Summary: &FileSummary{Stat: &Stat{}}},
+				{OrigName: "mod.txt", NewName: "mod.txt", Summary: &FileSummary{Stat: &Stat{Added: 2, Deleted: 1}}},
+				{OrigName: "sp ace.txt", NewName: "sp ace.txt", Summary: &FileSummary{Stat: &Stat{Added: 1}}},
+			},
+		},
+		{
+			filename: "sample_summary.stat",
+			format:   SummaryStat,
+			wantDiffs: []*FileDiff{
+				{OrigName: "add.txt", NewName: "add.txt", Summary: &FileSummary{Stat: &Stat{Added: 1}}},
+				{OrigName: "big.txt", NewName: "big.txt", Summary: &FileSummary{Stat: &Stat{Added: 300}}},
+				{OrigName: "bin.dat", NewName: "bin.dat", Summary: &FileSummary{Binary: true, OrigSize: 2, NewSize: 3}},
+				{OrigName: "del.txt", NewName: "del.txt", Summary: &FileSummary{Stat: &Stat{Deleted: 1}}},
+				{OrigName: "dir/old.txt", NewName: "dir/new.txt", Summary: &FileSummary{Stat: &Stat{Added: 1}}},
+				{OrigName: "exec.sh", NewName: "exec.sh", Summary: &FileSummary{Stat: &Stat{}}},
+				{OrigName: "mod.txt", NewName: "mod.txt", Summary: &FileSummary{Stat: &Stat{Added: 2, Deleted: 1}}},
+				{OrigName: "sp ace.txt", NewName: "sp ace.txt", Summary: &FileSummary{Stat: &Stat{Added: 1}}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			diffData, err := os.ReadFile(filepath.Join("testdata", test.filename))
+			if err != nil {
+				t.Fatal(err)
+			}
+			diffs, err := ParseSummary(diffData, test.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(diffs, test.wantDiffs) {
+				t.Errorf("got - want:\n%s", cmp.Diff(test.wantDiffs, diffs))
+			}
+
+			if !test.printable {
+				return
+			}
+			printed, err := PrintSummary(diffs, test.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(printed, diffData) {
+				t.Errorf("printed summary != original summary\n\n# PrintSummary output - Original:\n%s", cmp.Diff(diffData, printed))
+			}
+		})
+	}
+}
+
+func TestFileDiff_Stat_Summary(t *testing.T) {
+	fd := &FileDiff{Summary: &FileSummary{Stat: &Stat{Added: 3, Deleted: 2}}}
+	if got, want := fd.Stat(), (Stat{Added: 3, Deleted: 2}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseStatLine_Scaled(t *testing.T) {
+	fd, err := parseStatLine(" big.txt | 400 +++++++++++++++++++++++++++++++-------------")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := *fd.Summary.Stat, (Stat{Added: 282, Deleted: 118}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSplitRenamePath(t *testing.T) {
+	tests := []struct {
+		input, orig, new string
+	}{
+		{input: "a.txt", orig: "a.txt", new: "a.txt"},
+		{input: "a.txt => b.txt", orig: "a.txt", new: "b.txt"},
+		{input: "dir/{old.txt => new.txt}", orig: "dir/old.txt", new: "dir/new.txt"},
+		{input: "{a => b}/file", orig: "a/file", new: "b/file"},
+		{input: "src/{ => sub}/file", orig: "src/file", new: "src/sub/file"},
+	}
+	for _, tc := range tests {
+		orig, new := splitRenamePath(tc.input)
+		if orig != tc.orig || new != tc.new {
+			t.Errorf("splitRenamePath(%q): expected %q and %q, got %q and %q", tc.input, tc.orig, tc.new, orig, new)
+		}
+		if tc.orig != tc.new {
+			if got := renamePath(tc.orig, tc.new); got != tc.input {
+				t.Errorf("renamePath(%q, %q): expected %q, got %q", tc.orig, tc.new, tc.input, got)
+			}
+		}
+	}
+}
+
+func TestParseSummary_QuotedPath(t *testing.T) {
+	input := ":100644 100644 1234567 89abcde M\t\"caf\\303\\251.txt\"\n"
+	diffs, err := ParseSummary([]byte(input), SummaryRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].OrigName != "café.txt" {
+		t.Fatalf("got %+v, want one diff for café.txt", diffs)
+	}
+	printed, err := PrintSummary(diffs, SummaryRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(printed) != input {
+		t.Errorf("got %q, want %q", printed, input)
+	}
+}
+
+func TestParseSummary_Error(t *testing.T) {
+	_, err := ParseSummary([]byte("1\t2\ta.txt\nnope\n"), SummaryNumstat)
+	want := &ParseError{2, 13, &ErrBadSummaryLine{Line: "nope"}}
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("got err %v, want %v", err, want)
+	}
+}
@@ -0,0 +1,153 @@
+package diff
+
+import (
+	"context"
+	"io"
+)
+
+// A Handler receives the events of a unified diff as Walk reads it. The
+// byte slices passed to its methods are only valid until the method
+// returns. If a method returns an error, Walk stops and returns it.
+type Handler interface {
+	// ExtendedHeader is called for each line of a file's Preamble and
+	// Extended headers before the file's FileHeader call: git extended
+	// headers such as "diff --git" and "index", and any other lines
+	// preceding a file (e.g., an "Index:" banner or a commit message). It
+	// is also called for each line of the epilogue after the last file.
+	ExtendedHeader(line []byte) error
+
+	// FileHeader is called for each file: for its "---"/"+++" header pair,
+	// for a message from a recursive diff such as "Only in", or for a git
+	// diff that only has extended headers (such as an empty new file or a
+	// rename). fd is the FileDiff without its Hunks.
+	FileHeader(fd *FileDiff) error
+
+	// HunkHeader is called for each hunk header. Only the header fields
+	// of h are set; its Body is nil.
+	HunkHeader(h *Hunk) error
+
+	// BodyLine is called for each line of a hunk body, including its
+	// prefix character (' ', '-', '+' or '\') but not its newline.
+	BodyLine(line []byte) error
+}
+
+// HandlerFuncs is a Handler that calls the non-nil function for each event
+// and ignores the others.
+type HandlerFuncs struct {
+	OnExtendedHeader func(line []byte) error
+	OnFileHeader     func(fd *FileDiff) error
+	OnHunkHeader     func(h *Hunk) error
+	OnBodyLine       func(line []byte) error
+}
+
+func (h HandlerFuncs) ExtendedHeader(line []byte) error {
+	if h.OnExtendedHeader == nil {
+		return nil
+	}
+	return h.OnExtendedHeader(line)
+}
+
+func (h HandlerFuncs) FileHeader(fd *FileDiff) error {
+	if h.OnFileHeader == nil {
+		return nil
+	}
+	return h.OnFileHeader(fd)
+}
+
+func (h HandlerFuncs) HunkHeader(hunk *Hunk) error {
+	if h.OnHunkHeader == nil {
+		return nil
+	}
+	return h.OnHunkHeader(hunk)
+}
+
+func (h HandlerFuncs) BodyLine(line []byte) error {
+	if h.OnBodyLine == nil {
+		return nil
+	}
+	return h.OnBodyLine(line)
+}
+
+// Walk reads a multi-file unified diff from r and calls h for each event.
+// It never builds a hunk's Body: each body line is passed to h as it is
+// read, so its memory use does not grow with the size of hunks. It reads
+// the same input as MultiFileDiffReader (which it uses to read it), so it
+// calls FileHeader once for each FileDiff that ParseMultiFileDiff would
+// return.
+func Walk(r io.Reader, h Handler) error {
+	return WalkOptions(r, ParseOptions{}, h)
+}
+
+// WalkOptions is like Walk, but uses the given options, including their
+// limits on the input.
+func WalkOptions(r io.Reader, opts ParseOptions, h Handler) error {
+	return walk(NewMultiFileDiffReaderOptions(r, opts), h)
+}
+
+// WalkContext is like WalkOptions, but stops with ctx's error (in a
+// ParseError) once ctx is done.
+func WalkContext(ctx context.Context, r io.Reader, opts ParseOptions, h Handler) error {
+	return walk(NewMultiFileDiffReaderContext(ctx, r, opts), h)
+}
+
+func walk(r *MultiFileDiffReader, h Handler) error {
+	for {
+		fd, hr, _, err := r.readFileHeaders()
+		if err == io.EOF {
+			return walkLines(h, r.Epilogue())
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.countFile(); err != nil {
+			return err
+		}
+		if err := walkLines(h, fd.Preamble); err != nil {
+			return err
+		}
+		if err := walkLines(h, fd.Extended); err != nil {
+			return err
+		}
+		if err := h.FileHeader(fd); err != nil {
+			return err
+		}
+		if hr == nil {
+			continue
+		}
+
+		for {
+			_, err := hr.readHunk(h)
+			if e, ok := err.(handlerError); ok {
+				return e.err
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				if err := r.endHunks(hr, err); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+}
+
+// A handlerError is an error returned by a Handler while reading a hunk.
+type handlerError struct {
+	err error
+}
+
+func (e handlerError) Error() string {
+	return e.err.Error()
+}
+
+// walkLines calls h.ExtendedHeader for each of lines.
+func walkLines(h Handler, lines []string) error {
+	for _, line := range lines {
+		if err := h.ExtendedHeader([]byte(line)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
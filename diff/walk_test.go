@@ -0,0 +1,167 @@
+package diff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// walkDiff rebuilds the file diffs of data from Walk's events, with each
+// file's hunks printed as its Hunks would be by PrintHunks.
+func walkDiff(data []byte, opts ParseOptions) (fds []*FileDiff, hunks []string, epilogue []string, err error) {
+	var lines []string
+	var hunk bytes.Buffer
+	err = WalkOptions(bytes.NewReader(data), opts, HandlerFuncs{
+		OnExtendedHeader: func(line []byte) error {
+			lines = append(lines, string(line))
+			return nil
+		},
+		OnFileHeader: func(fd *FileDiff) error {
+			if want := append(append([]string(nil), fd.Preamble...), fd.Extended...); !equalLines(lines, want) {
+				return fmt.Errorf("got extended header events %q for %s, want %q", lines, fd.NewName, want)
+			}
+			lines = nil
+			fds = append(fds, fd)
+			hunks = append(hunks, "")
+			return nil
+		},
+		OnHunkHeader: func(h *Hunk) error {
+			if h.Body != nil {
+				return fmt.Errorf("got hunk body %q, want none", h.Body)
+			}
+			hunk.Reset()
+			if err := printHunkHeader(&hunk, h.OrigStartLine, h.OrigLines, h.NewStartLine, h.NewLines, h.Section); err != nil {
+				return err
+			}
+			hunks[len(hunks)-1] += hunk.String()
+			return nil
+		},
+		OnBodyLine: func(line []byte) error {
+			hunks[len(hunks)-1] += string(line) + "\n"
+			return nil
+		},
+	})
+	return fds, hunks, lines, err
+}
+
+// equalLines reports whether a and b have the same lines, where nil and
+// empty are the same.
+func equalLines(a, b []string) bool {
+	return len(a) == 0 && len(b) == 0 || cmp.Equal(a, b)
+}
+
+func TestWalk(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "*.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fixture := range fixtures {
+		t.Run(filepath.Base(fixture), func(t *testing.T) {
+			data, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := NewMultiFileDiffReader(bytes.NewReader(data))
+			want, wantErr := r.ReadAllFiles()
+			got, gotHunks, epilogue, err := walkDiff(data, ParseOptions{})
+			if (err != nil) != (wantErr != nil) {
+				t.Fatalf("got err %v, want %v", err, wantErr)
+			}
+			if wantErr != nil {
+				return
+			}
+			if len(got) != len(want) {
+				t.Fatalf("got %d files, want %d", len(got), len(want))
+			}
+			for i, fd := range want {
+				wantHunks, err := PrintHunks(fd.Hunks)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if gotHunks[i] != string(wantHunks) {
+					t.Errorf("file %d: got - want hunks:\n%s", i, cmp.Diff(string(wantHunks), gotHunks[i]))
+				}
+				fd.Hunks, fd.InvalidUTF8 = nil, false
+				if !cmp.Equal(got[i], fd) {
+					t.Errorf("file %d: got - want:\n%s", i, cmp.Diff(fd, got[i]))
+				}
+			}
+			if !equalLines(epilogue, r.Epilogue()) {
+				t.Errorf("got - want epilogue:\n%s", cmp.Diff(r.Epilogue(), epilogue))
+			}
+		})
+	}
+}
+
+func TestWalk_Limits(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sample_multi_file.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		opts    ParseOptions
+		wantErr error
+	}{
+		"hunk":  {opts: ParseOptions{MaxHunkBytes: 100}, wantErr: ErrHunkTooLarge},
+		"files": {opts: ParseOptions{MaxFiles: 1}, wantErr: ErrTooManyFiles},
+		"hunks": {opts: ParseOptions{MaxHunksPerFile: 1}, wantErr: ErrTooManyHunks},
+	}
+	for label, test := range tests {
+		_, _, _, err := walkDiff(data, test.opts)
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: got err %v, want %v", label, err, test.wantErr)
+		}
+	}
+}
+
+func TestWalk_HandlerError(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sample_multi_file.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errStop := errors.New("stop")
+	var files int
+	err = Walk(bytes.NewReader(data), HandlerFuncs{
+		OnFileHeader: func(fd *FileDiff) error {
+			files++
+			return errStop
+		},
+	})
+	if err != errStop {
+		t.Errorf("got err %v, want %v", err, errStop)
+	}
+	if files != 1 {
+		t.Errorf("got %d file headers, want 1", files)
+	}
+}
+
+// largeHunkDiff returns a diff of a file with a single hunk of n lines.
+func largeHunkDiff(n int) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "--- a/f\n+++ b/f\n@@ -1,%d +1,%d @@\n", n, n)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "-line %d\n+LINE %d\n", i, i)
+	}
+	return b.Bytes()
+}
+
+func TestWalk_LargeHunk(t *testing.T) {
+	allocs := func(n int) float64 {
+		data := largeHunkDiff(n)
+		return testing.AllocsPerRun(5, func() {
+			if err := Walk(bytes.NewReader(data), HandlerFuncs{}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	// Lines are passed on as they are read, so a larger hunk takes no more
+	// allocations.
+	if small, large := allocs(100), allocs(100000); large > small {
+		t.Errorf("got %v allocations for a hunk of 100000 lines, want no more than the %v for 100 lines", large, small)
+	}
+}
@@ -0,0 +1,390 @@
+package diff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A WordDiffFormat is one of the output formats of `git diff --word-diff`.
+type WordDiffFormat int
+
+const (
+	// WordDiffPlain is `--word-diff=plain` (the default), which marks
+	// changes inline as [-deleted-] and {+inserted+}.
+	WordDiffPlain WordDiffFormat = iota
+
+	// WordDiffPorcelain is `--word-diff=porcelain`, which prints each
+	// segment on its own line prefixed with ' ', '-' or '+', and ends
+	// each line of the file with a line containing only '~'.
+	WordDiffPorcelain
+)
+
+// A WordOp says whether a WordSegment is unchanged, deleted or inserted.
+type WordOp int
+
+const (
+	// WordContext is text present on both sides.
+	WordContext WordOp = iota
+	// WordDeleted is text only present in the original file.
+	WordDeleted
+	// WordInserted is text only present in the new file.
+	WordInserted
+)
+
+// A WordSegment is a run of text within a word diff line that is either
+// unchanged, deleted or inserted.
+type WordSegment struct {
+	Op   WordOp
+	Text string
+}
+
+// A WordDiffLine is one line of a word diff, made up of segments.
+type WordDiffLine []WordSegment
+
+// A WordDiffHunk is a hunk of `git diff --word-diff` output. Its header is
+// the same as a unified diff hunk's, but its body describes inline
+// insertions and deletions within each line.
+type WordDiffHunk struct {
+	// starting line number in original file
+	OrigStartLine int32
+	// number of lines the hunk applies to in the original file
+	OrigLines int32
+	// starting line number in new file
+	NewStartLine int32
+	// number of lines the hunk applies to in the new file
+	NewLines int32
+	// optional section heading
+	Section string
+	// lines of the hunk body
+	Lines []WordDiffLine
+}
+
+// ParseWordDiffHunks parses hunks from `git diff --word-diff` output in the
+// given format. Like ParseHunks, the diff must consist only of hunks.
+func ParseWordDiffHunks(diff []byte, format WordDiffFormat) ([]*WordDiffHunk, error) {
+	return ParseWordDiffHunksOptions(diff, format, ParseOptions{})
+}
+
+// ParseWordDiffHunksOptions parses word diff hunks with the given options.
+func ParseWordDiffHunksOptions(diff []byte, format WordDiffFormat, opts ParseOptions) ([]*WordDiffHunk, error) {
+	return NewWordDiffHunksReaderOptions(bytes.NewReader(diff), format, opts).ReadAllHunks()
+}
+
+// NewWordDiffHunksReader returns a new WordDiffHunksReader that reads word
+// diff hunks in the given format from r.
+func NewWordDiffHunksReader(r io.Reader, format WordDiffFormat) *WordDiffHunksReader {
+	return NewWordDiffHunksReaderOptions(r, format, ParseOptions{})
+}
+
+// NewWordDiffHunksReaderOptions returns a new WordDiffHunksReader that reads
+// word diff hunks in the given format from r with the given options.
+func NewWordDiffHunksReaderOptions(r io.Reader, format WordDiffFormat, opts ParseOptions) *WordDiffHunksReader {
+	return &WordDiffHunksReader{reader: newLineReaderOptions(r, opts), format: format}
+}
+
+// WordDiffHunksReader returns a new WordDiffHunksReader that reads word
+// diff hunks in the given format from r, starting where the file diff
+// header ended (see HunksReader). The hunks end at the next file's header,
+// which is left for r to read, so that the files of a multi-file word diff
+// can be read by calling r.ReadAllHeaders and this method in turn.
+func (r *FileDiffReader) WordDiffHunksReader(format WordDiffFormat) *WordDiffHunksReader {
+	return &WordDiffHunksReader{
+		line:   r.line,
+		offset: r.offset,
+		reader: r.reader,
+		format: format,
+		file:   r,
+	}
+}
+
+// A WordDiffHunksReader reads hunks from `git diff --word-diff` output.
+type WordDiffHunksReader struct {
+	line   int
+	offset int64
+	reader *lineReader
+	format WordDiffFormat
+
+	// file is the FileDiffReader the hunks are read for, if any, which the
+	// next file's header line is given back to (see its fileHeaderLine
+	// field), and fileDone is whether that happened.
+	file     *FileDiffReader
+	fileDone bool
+
+	nextHunkHeaderLine []byte
+}
+
+// ReadHunk reads one hunk from r. If there are no more hunks, it returns
+// error io.EOF.
+func (r *WordDiffHunksReader) ReadHunk() (*WordDiffHunk, error) {
+	if r.fileDone {
+		return nil, io.EOF
+	}
+	var hunk *WordDiffHunk
+	var pending WordDiffLine // porcelain segments not yet terminated by '~'
+	for {
+		var line []byte
+		if r.nextHunkHeaderLine != nil {
+			line = r.nextHunkHeaderLine
+			r.nextHunkHeaderLine = nil
+		} else {
+			var err error
+			line, err = r.reader.readLine()
+			if err != nil {
+				if err == io.EOF && hunk != nil {
+					if pending != nil {
+						hunk.Lines = append(hunk.Lines, pending)
+					}
+					return hunk, nil
+				}
+				return nil, err
+			}
+		}
+
+		// Record position.
+		r.line++
+		r.offset += int64(len(line))
+
+		if hunk == nil {
+			if !bytes.HasPrefix(line, hunkPrefix) {
+				return nil, &ParseError{r.line, r.offset, ErrNoHunkHeader}
+			}
+			var h Hunk
+			if err := parseHunkHeader(line, &h); err != nil {
+				return nil, &ParseError{r.line, r.offset, err}
+			}
+			hunk = &WordDiffHunk{
+				OrigStartLine: h.OrigStartLine,
+				OrigLines:     h.OrigLines,
+				NewStartLine:  h.NewStartLine,
+				NewLines:      h.NewLines,
+				Section:       h.Section,
+			}
+			continue
+		}
+
+		// If the line starts with the hunk prefix or the next file's
+		// header, this hunk is complete. Plain word diff lines have no
+		// prefix, so the end of the file can't be told from a line that
+		// does not belong to the hunk.
+		fileHeader, err := r.isFileHeader(line)
+		if err != nil {
+			return hunk, err
+		}
+		if fileHeader || bytes.HasPrefix(line, hunkPrefix) {
+			r.line--
+			r.offset -= int64(len(line))
+			if fileHeader && r.file != nil {
+				r.file.fileHeaderLine = line
+				r.file.line, r.file.offset = r.line, r.offset
+				r.fileDone = true
+			} else {
+				r.nextHunkHeaderLine = line
+			}
+			if pending != nil {
+				hunk.Lines = append(hunk.Lines, pending)
+			}
+			return hunk, nil
+		}
+
+		switch r.format {
+		case WordDiffPlain:
+			wl, err := parsePlainWordDiffLine(string(line))
+			if err != nil {
+				return hunk, &ParseError{r.line, r.offset, err}
+			}
+			hunk.Lines = append(hunk.Lines, wl)
+
+		case WordDiffPorcelain:
+			if len(line) == 0 {
+				return hunk, &ParseError{r.line, r.offset, &ErrBadWordDiffLine{Line: line}}
+			}
+			var op WordOp
+			switch line[0] {
+			case '~':
+				if pending == nil {
+					pending = WordDiffLine{}
+				}
+				hunk.Lines = append(hunk.Lines, pending)
+				pending = nil
+				continue
+			case ' ':
+				op = WordContext
+			case '-':
+				op = WordDeleted
+			case '+':
+				op = WordInserted
+			default:
+				return hunk, &ParseError{r.line, r.offset, &ErrBadWordDiffLine{Line: line}}
+			}
+			pending = append(pending, WordSegment{Op: op, Text: string(line[1:])})
+
+		default:
+			return nil, fmt.Errorf("unknown word diff format %d", r.format)
+		}
+	}
+}
+
+// isFileHeader reports whether line starts the header of the next file: a
+// "diff --git" line, or a "---" line followed by a "+++" line and a hunk
+// header (as HunksReader checks).
+func (r *WordDiffHunksReader) isFileHeader(line []byte) (bool, error) {
+	if bytes.HasPrefix(line, []byte("diff --git ")) {
+		return true, nil
+	}
+	if !bytes.HasPrefix(line, []byte("--- ")) {
+		return false, nil
+	}
+	if ok, err := r.reader.nextLineStartsWith("+++ "); !ok || err != nil {
+		return false, err
+	}
+	ok, _ := r.reader.nextNextLineStartsWith(string(hunkPrefix))
+	return ok, nil
+}
+
+// ReadAllHunks reads all remaining hunks from r. A successful call returns
+// err == nil, not err == EOF.
+func (r *WordDiffHunksReader) ReadAllHunks() ([]*WordDiffHunk, error) {
+	var hunks []*WordDiffHunk
+	for {
+		hunk, err := r.ReadHunk()
+		if err == io.EOF {
+			return hunks, nil
+		}
+		if hunk != nil {
+			hunks = append(hunks, hunk)
+		}
+		if err != nil {
+			return hunks, err
+		}
+	}
+}
+
+const (
+	wordDeletedStart  = "[-"
+	wordDeletedEnd    = "-]"
+	wordInsertedStart = "{+"
+	wordInsertedEnd   = "+}"
+)
+
+// ErrUnterminatedWordMarker is when a [- or {+ marker in a plain
+// word diff line is not closed on the same line.
+var ErrUnterminatedWordMarker = errors.New("unterminated word diff marker")
+
+// parsePlainWordDiffLine splits a line of `--word-diff=plain` output into
+// segments. git closes the markers at the end of every line, so a marker
+// never spans lines.
+func parsePlainWordDiffLine(line string) (WordDiffLine, error) {
+	wl := WordDiffLine{}
+	for len(line) > 0 {
+		del := indexOrLen(line, wordDeletedStart)
+		ins := indexOrLen(line, wordInsertedStart)
+		start := del
+		if ins < start {
+			start = ins
+		}
+		if start > 0 {
+			wl = append(wl, WordSegment{Op: WordContext, Text: line[:start]})
+		}
+		if start == len(line) {
+			break
+		}
+		line = line[start:]
+
+		op, endMarker := WordDeleted, wordDeletedEnd
+		if start == ins {
+			op, endMarker = WordInserted, wordInsertedEnd
+		}
+		end := strings.Index(line[2:], endMarker)
+		if end < 0 {
+			return nil, ErrUnterminatedWordMarker
+		}
+		wl = append(wl, WordSegment{Op: op, Text: line[2 : 2+end]})
+		line = line[2+end+len(endMarker):]
+	}
+	return wl, nil
+}
+
+func indexOrLen(s, substr string) int {
+	if i := strings.Index(s, substr); i >= 0 {
+		return i
+	}
+	return len(s)
+}
+
+// ErrBadWordDiffLine is when a line that is not valid in the word diff
+// format being read is encountered while reading a hunk.
+type ErrBadWordDiffLine struct {
+	Line []byte
+}
+
+func (e *ErrBadWordDiffLine) Error() string {
+	m := "bad word diff line (does not start with ' ', '-', '+', or '~')"
+	if len(e.Line) == 0 {
+		return m
+	}
+	return m + ": " + string(e.Line)
+}
+
+// PrintWordDiffHunks prints word diff hunks in the given format.
+func PrintWordDiffHunks(hunks []*WordDiffHunk, format WordDiffFormat) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, hunk := range hunks {
+		if err := printHunkHeader(&buf, hunk.OrigStartLine, hunk.OrigLines, hunk.NewStartLine, hunk.NewLines, hunk.Section); err != nil {
+			return nil, err
+		}
+		for _, line := range hunk.Lines {
+			var err error
+			switch format {
+			case WordDiffPlain:
+				err = printPlainWordDiffLine(&buf, line)
+			case WordDiffPorcelain:
+				err = printPorcelainWordDiffLine(&buf, line)
+			default:
+				err = fmt.Errorf("unknown word diff format %d", format)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func printPlainWordDiffLine(w io.Writer, line WordDiffLine) error {
+	for _, seg := range line {
+		var err error
+		switch seg.Op {
+		case WordDeleted:
+			_, err = fmt.Fprint(w, wordDeletedStart, seg.Text, wordDeletedEnd)
+		case WordInserted:
+			_, err = fmt.Fprint(w, wordInsertedStart, seg.Text, wordInsertedEnd)
+		default:
+			_, err = fmt.Fprint(w, seg.Text)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+func printPorcelainWordDiffLine(w io.Writer, line WordDiffLine) error {
+	for _, seg := range line {
+		prefix := " "
+		switch seg.Op {
+		case WordDeleted:
+			prefix = "-"
+		case WordInserted:
+			prefix = "+"
+		}
+		if _, err := fmt.Fprintln(w, prefix+seg.Text); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "~")
+	return err
+}
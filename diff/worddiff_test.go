@@ -0,0 +1,156 @@
+package diff
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseWordDiffHunks(t *testing.T) {
+	want := []*WordDiffHunk{
+		{
+			OrigStartLine: 1, OrigLines: 5, NewStartLine: 1, NewLines: 5,
+			Lines: []WordDiffLine{
+				{{WordContext, "hello "}, {WordDeleted, "world"}, {WordInserted, "there"}},
+				{{WordContext, "same line"}},
+				{{WordContext, "the "}, {WordDeleted, "quick"}, {WordInserted, "slow"}, {WordContext, " brown "}, {WordDeleted, "fox"}, {WordInserted, "dog"}},
+				{},
+				{{WordContext, "end "}, {WordInserted, "here"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		filename string
+		format   WordDiffFormat
+	}{
+		{filename: "sample_word_diff_plain.worddiff", format: WordDiffPlain},
+		{filename: "sample_word_diff_porcelain.worddiff", format: WordDiffPorcelain},
+	}
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			diffData, err := os.ReadFile(filepath.Join("testdata", test.filename))
+			if err != nil {
+				t.Fatal(err)
+			}
+			hunks, err := ParseWordDiffHunks(diffData, test.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Porcelain output has a (blank) context segment for empty
+			// lines, plain output has none.
+			wantHunks := want
+			if test.format == WordDiffPorcelain {
+				wantHunks = []*WordDiffHunk{{}}
+				*wantHunks[0] = *want[0]
+				wantHunks[0].Lines = append([]WordDiffLine(nil), want[0].Lines...)
+				wantHunks[0].Lines[3] = WordDiffLine{{WordContext, ""}}
+			}
+			if !cmp.Equal(hunks, wantHunks) {
+				t.Errorf("got - want:\n%s", cmp.Diff(wantHunks, hunks))
+			}
+
+			printed, err := PrintWordDiffHunks(hunks, test.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(printed, diffData) {
+				t.Errorf("printed word diff != original word diff\n\n# PrintWordDiffHunks output - Original:\n%s", cmp.Diff(diffData, printed))
+			}
+		})
+	}
+}
+
+func TestParseWordDiffHunks_Errors(t *testing.T) {
+	tests := map[string]struct {
+		diff    string
+		format  WordDiffFormat
+		wantErr error
+	}{
+		"no hunk header": {
+			diff:    "hello [-world-]\n",
+			format:  WordDiffPlain,
+			wantErr: &ParseError{1, 15, ErrNoHunkHeader},
+		},
+		"unterminated marker": {
+			diff:    "@@ -1 +1 @@\nhello [-world\n",
+			format:  WordDiffPlain,
+			wantErr: &ParseError{2, 24, ErrUnterminatedWordMarker},
+		},
+		"bad porcelain line": {
+			diff:    "@@ -1 +1 @@\n hello\n*world\n",
+			format:  WordDiffPorcelain,
+			wantErr: &ParseError{3, 23, &ErrBadWordDiffLine{Line: []byte("*world")}},
+		},
+	}
+	for label, test := range tests {
+		_, err := ParseWordDiffHunks([]byte(test.diff), test.format)
+		if !reflect.DeepEqual(err, test.wantErr) {
+			t.Errorf("%s: got err %v, want %v", label, err, test.wantErr)
+		}
+	}
+}
+
+func TestReadWordDiffHunks_MultiFile(t *testing.T) {
+	input := `diff --git a/a.txt b/a.txt
+index 1234567..89abcde 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1 +1 @@
+hello [-world-]{+there+}
+diff --git a/b.txt b/b.txt
+index 1234567..89abcde 100644
+--- a/b.txt
++++ b/b.txt
+@@ -1,2 +1,2 @@
+same line
+{+new+} words
+`
+	want := []struct {
+		name  string
+		hunks []*WordDiffHunk
+	}{
+		{"b/a.txt", []*WordDiffHunk{{
+			OrigStartLine: 1, OrigLines: 1, NewStartLine: 1, NewLines: 1,
+			Lines: []WordDiffLine{{{WordContext, "hello "}, {WordDeleted, "world"}, {WordInserted, "there"}}},
+		}}},
+		{"b/b.txt", []*WordDiffHunk{{
+			OrigStartLine: 1, OrigLines: 2, NewStartLine: 1, NewLines: 2,
+			Lines: []WordDiffLine{{{WordContext, "same line"}}, {{WordInserted, "new"}, {WordContext, " words"}}},
+		}}},
+	}
+
+	r := NewFileDiffReader(strings.NewReader(input))
+	for _, w := range want {
+		fd, err := r.ReadAllHeaders()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fd.NewName != w.name {
+			t.Errorf("got NewName %q, want %q", fd.NewName, w.name)
+		}
+		hunks, err := r.WordDiffHunksReader(WordDiffPlain).ReadAllHunks()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cmp.Equal(hunks, w.hunks) {
+			t.Errorf("%s: got - want:\n%s", w.name, cmp.Diff(w.hunks, hunks))
+		}
+	}
+
+	// Without a FileDiffReader to give the next file's header to, the
+	// header is not taken as part of the hunk.
+	hunks, err := ParseWordDiffHunks([]byte(input[strings.Index(input, "@@"):]), WordDiffPlain)
+	if err == nil {
+		t.Errorf("got no error, want one")
+	}
+	if len(hunks) != 1 || len(hunks[0].Lines) != 1 {
+		t.Errorf("got %d hunks, want 1 hunk with 1 line", len(hunks))
+	}
+}